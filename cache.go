@@ -0,0 +1,93 @@
+package confetti
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"time"
+)
+
+// cacheHeader precedes the cached config, recording when it was saved.
+type cacheHeader struct {
+	SavedAt time.Time
+}
+
+// SaveCache writes v, typically config that's already been loaded, to path using
+// [encoding/gob] so that [LoadCache] can restore it without parsing every source again.
+// Only what gob can encode is cached, so unexported fields are left out and fields of
+// types like *regexp.Regexp aren't supported.
+func SaveCache(v any, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("saving config cache: %w", err)
+	}
+	defer file.Close()
+
+	enc := gob.NewEncoder(file)
+	if err := enc.Encode(cacheHeader{SavedAt: time.Now()}); err != nil {
+		return fmt.Errorf("saving config cache: %w", err)
+	}
+
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("saving config cache: %w", err)
+	}
+
+	return file.Close()
+}
+
+// LoadCache restores config saved by [SaveCache] at path into v, a pointer, reporting
+// whether it did. The cache is only trusted if none of the given source files have been
+// modified since it was saved. A missing cache or source file or a stale cache leaves v
+// untouched and reports false without an error, signaling the config should be loaded
+// from its sources instead. v is replaced entirely when the cache is restored, so fields
+// holding zero values when it was saved are zeroed in v too.
+func LoadCache(v any, path string, sources ...string) (bool, error) {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return false, fmt.Errorf("loading config cache: expected a non-nil pointer, got %T", v)
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("loading config cache: %w", err)
+	}
+	defer file.Close()
+
+	dec := gob.NewDecoder(file)
+	var header cacheHeader
+	if err := dec.Decode(&header); err != nil {
+		return false, fmt.Errorf("loading config cache: %w", err)
+	}
+
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, fmt.Errorf("loading config cache: %w", err)
+		}
+
+		if info.ModTime().After(header.SavedAt) {
+			return false, nil
+		}
+	}
+
+	// gob leaves fields holding zero values alone and may fail partway through, so decode
+	// into a fresh value and only assign it to v once it's complete
+	decoded := reflect.New(target.Elem().Type())
+	if err := dec.Decode(decoded.Interface()); err != nil {
+		return false, fmt.Errorf("loading config cache: %w", err)
+	}
+
+	target.Elem().Set(decoded.Elem())
+	return true, nil
+}
@@ -0,0 +1,48 @@
+package confetti_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	source := writeFile(t, ".env", "LOAD_HOST=cached\nLOAD_TAGS=x,y")
+	cachePath := filepath.Join(t.TempDir(), "config.gob")
+
+	cfg := loadConfig{}
+	ok, err := confetti.LoadCache(&cfg, cachePath, source)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	cfg, _, err = confetti.Load[loadConfig](confetti.WithFiles(source))
+	require.NoError(t, err)
+	require.NoError(t, confetti.SaveCache(cfg, cachePath))
+
+	// gob skips zero values, but they still replace whatever v held
+	cached := loadConfig{Verbose: true}
+	ok, err = confetti.LoadCache(&cached, cachePath, source)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, cfg, cached)
+
+	_, err = confetti.LoadCache(cached, cachePath, source)
+	require.Error(t, err)
+
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(source, future, future))
+
+	stale := loadConfig{}
+	ok, err = confetti.LoadCache(&stale, cachePath, source)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, loadConfig{}, stale)
+
+	ok, err = confetti.LoadCache(&stale, cachePath, source+".missing")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
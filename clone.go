@@ -0,0 +1,110 @@
+package confetti
+
+import "reflect"
+
+// Clone returns a deep copy of cfg, following pointers and copying slices and maps so
+// the clone's exported fields share no mutable state with the original. Unexported
+// fields are copied shallowly. Pointers that appear more than once, including cycles,
+// are copied once and shared the same way in the clone. Pointers to values confetti
+// treats as immutable, like [*time.Location], [*regexp.Regexp] and [*x509.Certificate],
+// are shared rather than copied. This is useful for taking a snapshot of config before
+// applying new sources so it can be rolled back.
+func Clone[T any](cfg T) T {
+	src := reflect.ValueOf(&cfg).Elem()
+	dst := reflect.New(src.Type()).Elem()
+	deepCopy(dst, src)
+	return dst.Interface().(T)
+}
+
+// deepCopy copies src into dst as described by [Clone].
+func deepCopy(dst, src reflect.Value) {
+	c := copier{seen: make(map[copiedPointer]reflect.Value)}
+	c.copy(dst, src)
+}
+
+// copiedPointer identifies a pointer that's already been copied. The type is needed
+// since a struct and its first field share an address.
+type copiedPointer struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// copier tracks the pointers copied so far so repeated pointers and cycles are copied
+// only once.
+type copier struct {
+	seen map[copiedPointer]reflect.Value
+}
+
+func (c copier) copy(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+
+		if sharesPointee(src.Type()) {
+			dst.Set(src)
+			return
+		}
+
+		key := copiedPointer{addr: src.Pointer(), typ: src.Type()}
+		if ptr, ok := c.seen[key]; ok {
+			dst.Set(ptr)
+			return
+		}
+
+		ptr := reflect.New(src.Type().Elem())
+		c.seen[key] = ptr
+		c.copy(ptr.Elem(), src.Elem())
+		dst.Set(ptr)
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+
+		slice := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		for i := range src.Len() {
+			c.copy(slice.Index(i), src.Index(i))
+		}
+		dst.Set(slice)
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+
+		m := reflect.MakeMapWithSize(src.Type(), src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			val := reflect.New(src.Type().Elem()).Elem()
+			c.copy(val, iter.Value())
+			m.SetMapIndex(iter.Key(), val)
+		}
+		dst.Set(m)
+	case reflect.Array:
+		for i := range src.Len() {
+			c.copy(dst.Index(i), src.Index(i))
+		}
+	case reflect.Struct:
+		// copying the whole struct first carries over unexported fields, which can't be
+		// set individually
+		dst.Set(src)
+		for i := range src.NumField() {
+			if dst.Field(i).CanSet() {
+				c.copy(dst.Field(i), src.Field(i))
+			}
+		}
+	default:
+		dst.Set(src)
+	}
+}
+
+// sharesPointee reports whether pointers of type t are copied by reference since they
+// point to values that are only ever replaced as a whole, never modified in place.
+func sharesPointee(t reflect.Type) bool {
+	switch t {
+	case locationType, regexpType, certificateType, tcpAddrType, udpAddrType:
+		return true
+	}
+
+	return coercesWhole(t.Elem())
+}
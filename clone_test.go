@@ -0,0 +1,91 @@
+package confetti_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClone(t *testing.T) {
+	type inner struct {
+		Hosts []string
+	}
+
+	type cloneConfig struct {
+		Name     string
+		Tags     []string
+		Limits   map[string]int
+		Inner    inner
+		Pointer  *inner
+		Nil      *inner
+		Matrix   [2][]int
+		internal []string
+	}
+
+	original := cloneConfig{
+		Name:     "original",
+		Tags:     []string{"a", "b"},
+		Limits:   map[string]int{"reads": 10},
+		Inner:    inner{Hosts: []string{"x"}},
+		Pointer:  &inner{Hosts: []string{"y"}},
+		Matrix:   [2][]int{{1}, {2}},
+		internal: []string{"kept"},
+	}
+
+	clone := confetti.Clone(original)
+	require.Equal(t, original, clone)
+
+	clone.Name = "clone"
+	clone.Tags[0] = "changed"
+	clone.Limits["reads"] = 20
+	clone.Limits["writes"] = 5
+	clone.Inner.Hosts[0] = "changed"
+	clone.Pointer.Hosts[0] = "changed"
+	clone.Matrix[0][0] = 100
+
+	require.Equal(t, "original", original.Name)
+	require.Equal(t, []string{"a", "b"}, original.Tags)
+	require.Equal(t, map[string]int{"reads": 10}, original.Limits)
+	require.Equal(t, []string{"x"}, original.Inner.Hosts)
+	require.Equal(t, []string{"y"}, original.Pointer.Hosts)
+	require.Equal(t, [2][]int{{1}, {2}}, original.Matrix)
+	require.Nil(t, clone.Nil)
+
+	ptr := confetti.Clone(&original)
+	require.NotSame(t, &original, ptr)
+	require.Equal(t, original, *ptr)
+}
+
+func TestCloneCycles(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+		Also *node
+	}
+
+	original := &node{Name: "a"}
+	original.Next = &node{Name: "b", Next: original}
+	original.Also = original.Next
+
+	clone := confetti.Clone(original)
+	require.NotSame(t, original, clone)
+	require.NotSame(t, original.Next, clone.Next)
+	require.Same(t, clone, clone.Next.Next)
+	require.Same(t, clone.Next, clone.Also)
+	require.Equal(t, "b", clone.Next.Name)
+}
+
+func TestCloneSharesImmutablePointers(t *testing.T) {
+	type zoneConfig struct {
+		Loc     *time.Location
+		Pattern *regexp.Regexp
+	}
+
+	original := zoneConfig{Loc: time.UTC, Pattern: regexp.MustCompile("^a+$")}
+	clone := confetti.Clone(original)
+	require.True(t, clone.Loc == time.UTC)
+	require.Same(t, original.Pattern, clone.Pattern)
+}
@@ -0,0 +1,850 @@
+package confetti
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image/color"
+	"maps"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUnsupportedKind is returned when a value is provided for a field whose kind can't
+// be coerced from a string, like a chan or func.
+var ErrUnsupportedKind = errors.New("unsupported kind")
+
+// ErrCoercion is matched by every error raised coercing a value into a field, so
+// callers can tell bad values apart from other failures using [errors.Is].
+var ErrCoercion = errors.New("coercion failed")
+
+// errNegative is raised for negative values given to fields with the `nonneg` option.
+var errNegative = errors.New("negative values aren't allowed by the nonneg option")
+
+// coercionError marks err as a coercion failure without changing its message.
+type coercionError struct {
+	err error
+}
+
+func (e coercionError) Error() string {
+	return e.err.Error()
+}
+
+func (e coercionError) Unwrap() []error {
+	return []error{ErrCoercion, e.err}
+}
+
+// An Unmarshaler parses its own config value. Fields whose type implements Unmarshaler,
+// or otherwise [encoding.TextUnmarshaler], are coerced through it, as are the elements
+// of slice and map fields. Failing both, types implementing [encoding.BinaryUnmarshaler]
+// are coerced from base64.
+type Unmarshaler interface {
+	UnmarshalConfig(value string) error
+}
+
+var (
+	unmarshalerType       = reflect.TypeFor[Unmarshaler]()
+	textUnmarshalerType   = reflect.TypeFor[encoding.TextUnmarshaler]()
+	binaryUnmarshalerType = reflect.TypeFor[encoding.BinaryUnmarshaler]()
+	textMarshalerType     = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+var (
+	durationType    = reflect.TypeFor[time.Duration]()
+	regexpType      = reflect.TypeFor[*regexp.Regexp]()
+	certificateType = reflect.TypeFor[*x509.Certificate]()
+	keyPairType     = reflect.TypeFor[tls.Certificate]()
+	locationType    = reflect.TypeFor[*time.Location]()
+	tcpAddrType     = reflect.TypeFor[*net.TCPAddr]()
+	udpAddrType     = reflect.TypeFor[*net.UDPAddr]()
+	rawMessageType  = reflect.TypeFor[json.RawMessage]()
+	colorType       = reflect.TypeFor[color.RGBA]()
+)
+
+// atomicTypes are coerced by parsing the type of value they hold and storing it.
+var atomicTypes = []reflect.Type{
+	reflect.TypeFor[atomic.Bool](),
+	reflect.TypeFor[atomic.Int32](),
+	reflect.TypeFor[atomic.Int64](),
+	reflect.TypeFor[atomic.Uint32](),
+	reflect.TypeFor[atomic.Uint64](),
+}
+
+// coercesWhole reports whether values of type t are coerced from a single value even
+// though they're structs, so they shouldn't be bound field by field.
+func coercesWhole(t reflect.Type) bool {
+	if t == keyPairType || t == colorType || slices.Contains(atomicTypes, t) {
+		return true
+	}
+
+	if implementsUnmarshaler(reflect.PointerTo(t)) {
+		return true
+	}
+
+	_, ok := lookupCoercer(t)
+	return ok
+}
+
+// coercers holds the custom coercion functions added with [RegisterCoercer].
+var (
+	coercersMu sync.RWMutex
+	coercers   = make(map[reflect.Type]func(reflect.Value, string) error)
+)
+
+// RegisterCoercer makes fields of type t coerced by fn, which is given a settable value
+// of type t and the string to parse into it. This allows config to use types that
+// confetti doesn't support natively and that you can't add methods to:
+//
+//	locType := reflect.TypeFor[time.Location]()
+//	confetti.RegisterCoercer(locType, func(val reflect.Value, str string) error {
+//		loc, err := time.LoadLocation(str)
+//		if err != nil {
+//			return err
+//		}
+//		val.Set(reflect.ValueOf(*loc))
+//		return nil
+//	})
+//
+// Registered coercers take precedence over the built in coercion, and struct types with
+// a coercer are coerced from a single value instead of being treated as nested config.
+// Registering a coercer for a type that already has one replaces it.
+func RegisterCoercer(t reflect.Type, fn func(reflect.Value, string) error) {
+	coercersMu.Lock()
+	defer coercersMu.Unlock()
+	coercers[t] = fn
+}
+
+// RegisterEnum registers a coercer for the enum type T that looks values up by name in
+// values, e.g. RegisterEnum(map[string]Color{"red": Red, "green": Green}). Names that
+// aren't in values are rejected. Enums are usually formatted by their String method, so
+// values should be its inverse for [Marshal] to round trip.
+func RegisterEnum[T any](values map[string]T) {
+	values = maps.Clone(values)
+	RegisterCoercer(reflect.TypeFor[T](), func(val reflect.Value, str string) error {
+		enumVal, ok := values[str]
+		if !ok {
+			return fmt.Errorf("unknown value, expected one of %q", slices.Sorted(maps.Keys(values)))
+		}
+
+		val.Set(reflect.ValueOf(enumVal))
+		return nil
+	})
+}
+
+// lookupCoercer returns the coercer registered for t, if any.
+func lookupCoercer(t reflect.Type) (func(reflect.Value, string) error, bool) {
+	coercersMu.RLock()
+	defer coercersMu.RUnlock()
+	fn, ok := coercers[t]
+	return fn, ok
+}
+
+// groupingReplacer strips the digit grouping allowed in integers with the `grouped` tag
+// option, e.g. 1,000,000 or 1_000_000.
+var groupingReplacer = strings.NewReplacer(",", "", "_", "")
+
+// coerceValue parses str into val according to val's type. The binding provides tag
+// options and the field name for error messages. For slice and map fields val may be an
+// element of the bound field rather than the field itself. Panics, like those raised by
+// a misbehaving [Unmarshaler], are recovered and returned as errors.
+func coerceValue(b *binding, val reflect.Value, str string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf(
+				"could not assign %q to %q: recovered from panic: %v",
+				str,
+				b.field.Name,
+				r,
+			)
+		}
+
+		if err != nil && !errors.Is(err, ErrCoercion) {
+			err = coercionError{err: err}
+		}
+	}()
+
+	if coerce, ok := lookupCoercer(val.Type()); ok {
+		if err := coerce(val, str); err != nil {
+			return fmt.Errorf("could not assign %q to %q: %w", str, b.field.Name, err)
+		}
+		return nil
+	}
+
+	if val.Type() == durationType {
+		// the `unit` option gives bare numbers a unit, e.g. 30 means 30s with unit=s
+		if unit, ok := b.opts["unit"]; ok {
+			if _, err := strconv.ParseFloat(str, 64); err == nil {
+				str += unit
+			}
+		}
+
+		duration, err := time.ParseDuration(str)
+		if err != nil {
+			return fmt.Errorf("could not assign %q to duration %q: %w", str, b.field.Name, err)
+		}
+
+		if duration < 0 && b.opts.has("nonneg") {
+			return fmt.Errorf("could not assign %q to duration %q: %w", str, b.field.Name, errNegative)
+		}
+		val.SetInt(int64(duration))
+		return nil
+	}
+
+	if val.Type() == regexpType {
+		re, err := regexp.Compile(str)
+		if err != nil {
+			return fmt.Errorf("could not assign %q to regexp %q: %w", str, b.field.Name, err)
+		}
+		val.Set(reflect.ValueOf(re))
+		return nil
+	}
+
+	if val.Type() == locationType {
+		loc, err := time.LoadLocation(str)
+		if err != nil {
+			return fmt.Errorf("could not assign %q to location %q: %w", str, b.field.Name, err)
+		}
+		val.Set(reflect.ValueOf(loc))
+		return nil
+	}
+
+	if val.Type() == tcpAddrType {
+		addr, err := net.ResolveTCPAddr("tcp", str)
+		if err != nil {
+			return fmt.Errorf("could not assign %q to TCP address %q: %w", str, b.field.Name, err)
+		}
+		val.Set(reflect.ValueOf(addr))
+		return nil
+	}
+
+	if val.Type() == udpAddrType {
+		addr, err := net.ResolveUDPAddr("udp", str)
+		if err != nil {
+			return fmt.Errorf("could not assign %q to UDP address %q: %w", str, b.field.Name, err)
+		}
+		val.Set(reflect.ValueOf(addr))
+		return nil
+	}
+
+	if val.Type() == rawMessageType {
+		// raw messages are stored verbatim, bypassing byte slice options like from=glob
+		if !json.Valid([]byte(str)) {
+			return fmt.Errorf("could not assign %q to raw message %q: invalid JSON", str, b.field.Name)
+		}
+		val.SetBytes([]byte(str))
+		return nil
+	}
+
+	if val.Type() == certificateType {
+		cert, err := parseCertificate(str)
+		if err != nil {
+			return fmt.Errorf("could not assign %q to certificate %q: %w", str, b.field.Name, err)
+		}
+		val.Set(reflect.ValueOf(cert))
+		return nil
+	}
+
+	if val.Type() == keyPairType {
+		// the same PEM provides both blocks, each parse skips blocks of the other type
+		keyPair, err := tls.X509KeyPair([]byte(str), []byte(str))
+		if err != nil {
+			return fmt.Errorf("could not assign %q to key pair %q: %w", str, b.field.Name, err)
+		}
+		val.Set(reflect.ValueOf(keyPair))
+		return nil
+	}
+
+	if slices.Contains(atomicTypes, val.Type()) {
+		store := val.Addr().MethodByName("Store")
+		held := reflect.New(store.Type().In(0)).Elem()
+		if err := coerceValue(b, held, str); err != nil {
+			return err
+		}
+		store.Call([]reflect.Value{held})
+		return nil
+	}
+
+	if val.Type() == colorType {
+		rgba, err := parseHexColor(str)
+		if err != nil {
+			return fmt.Errorf("could not assign %q to color %q: %w", str, b.field.Name, err)
+		}
+		val.Set(reflect.ValueOf(rgba))
+		return nil
+	}
+
+	if ok, err := unmarshalValue(val, str); ok {
+		if err != nil {
+			return fmt.Errorf("could not assign %q to %q: %w", str, b.field.Name, err)
+		}
+		return nil
+	}
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if b.opts.has("grouped") {
+			str = groupingReplacer.Replace(str)
+		}
+		fallthrough
+	case reflect.Float32, reflect.Float64:
+		if b.opts.has("strictnum") {
+			if err := checkStrictNum(str); err != nil {
+				return fmt.Errorf("could not assign %q to %q: %w", str, b.field.Name, err)
+			}
+		}
+	}
+
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(str)
+	case reflect.Bool:
+		boolVal, ok := parseBool(str)
+		if !ok {
+			return fmt.Errorf("could not assign %q to bool %q", str, b.field.Name)
+		}
+
+		// negated fields are configured by keys with the opposite meaning, e.g.
+		// DISABLE_FEATURE for an Enabled field
+		val.SetBool(boolVal != b.opts.has("negate"))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Bits respects the platform's width for plain ints, so out of range values
+		// error instead of overflowing
+		intVal, err := strconv.ParseInt(str, intBase(str), val.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("could not assign %q to int %q: %w", str, b.field.Name, err)
+		}
+
+		if intVal < 0 && b.opts.has("nonneg") {
+			return fmt.Errorf("could not assign %q to int %q: %w", str, b.field.Name, errNegative)
+		}
+		val.SetInt(intVal)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		uintVal, err := strconv.ParseUint(str, intBase(str), val.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("could not assign %q to uint %q: %w", str, b.field.Name, err)
+		}
+		val.SetUint(uintVal)
+	case reflect.Float32, reflect.Float64:
+		floatVal, err := strconv.ParseFloat(str, val.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("could not assign %q to float %q: %w", str, b.field.Name, err)
+		}
+
+		if (math.IsInf(floatVal, 0) || math.IsNaN(floatVal)) && !b.opts.has("allowNonFinite") {
+			return fmt.Errorf(
+				"could not assign %q to float %q: non-finite values require the allowNonFinite option",
+				str,
+				b.field.Name,
+			)
+		}
+
+		if floatVal < 0 && b.opts.has("nonneg") {
+			return fmt.Errorf("could not assign %q to float %q: %w", str, b.field.Name, errNegative)
+		}
+		val.SetFloat(floatVal)
+	case reflect.Slice:
+		if b.opts.has("runes") && val.Type().Elem().Kind() == reflect.Int32 {
+			// rune is an alias of int32, so the `runes` option tells rune slices holding
+			// the string as is apart from lists of int32s
+			val.Set(reflect.ValueOf([]rune(str)).Convert(val.Type()))
+			break
+		}
+
+		if val.Type().Elem().Kind() != reflect.Uint8 {
+			return coerceSlice(b, val, str)
+		}
+
+		if b.opts["from"] != "glob" {
+			val.Set(reflect.ValueOf([]byte(str)))
+			break
+		}
+
+		bundle, err := readGlob(str)
+		if err != nil {
+			return fmt.Errorf("could not assign %q to %q: %w", str, b.field.Name, err)
+		}
+		val.Set(reflect.ValueOf(bundle))
+	case reflect.Map:
+		return coerceMap(b, val, str)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return fmt.Errorf(
+			"could not assign %q to %s %q: %w",
+			str,
+			val.Kind(),
+			b.field.Name,
+			ErrUnsupportedKind,
+		)
+	case reflect.Struct:
+		if inner, valid, ok := nullable(val); ok {
+			if err := coerceValue(b, inner, str); err != nil {
+				return err
+			}
+			valid.SetBool(true)
+		}
+	}
+
+	return nil
+}
+
+// implementsUnmarshaler reports whether t implements [Unmarshaler],
+// [encoding.TextUnmarshaler] or [encoding.BinaryUnmarshaler].
+func implementsUnmarshaler(t reflect.Type) bool {
+	return t.Implements(unmarshalerType) ||
+		t.Implements(textUnmarshalerType) ||
+		t.Implements(binaryUnmarshalerType)
+}
+
+// unmarshalValue unmarshals str into val if its type, or a pointer to it, implements
+// [Unmarshaler], [encoding.TextUnmarshaler] or [encoding.BinaryUnmarshaler], reporting
+// whether it did. Pointers are only set once unmarshaling succeeds.
+func unmarshalValue(val reflect.Value, str string) (bool, error) {
+	if val.Kind() == reflect.Pointer {
+		if !implementsUnmarshaler(val.Type()) {
+			return false, nil
+		}
+
+		ptr := reflect.New(val.Type().Elem())
+		if err := unmarshal(ptr.Interface(), str); err != nil {
+			return true, err
+		}
+
+		val.Set(ptr)
+		return true, nil
+	}
+
+	if !val.CanAddr() || !implementsUnmarshaler(reflect.PointerTo(val.Type())) {
+		return false, nil
+	}
+
+	return true, unmarshal(val.Addr().Interface(), str)
+}
+
+// unmarshal calls the unmarshaling method of v, preferring [Unmarshaler].
+func unmarshal(v any, str string) error {
+	if u, ok := v.(Unmarshaler); ok {
+		return u.UnmarshalConfig(str)
+	}
+
+	if u, ok := v.(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(str))
+	}
+
+	// binary values are written to config as base64
+	data, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return err
+	}
+
+	return v.(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+}
+
+// parseCertificate decodes a PEM encoded x509 certificate.
+func parseCertificate(str string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(str))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// parseHexColor parses a hex color of the form #rrggbb or #rrggbbaa, with the leading #
+// being optional. Colors without an alpha channel are opaque.
+func parseHexColor(str string) (color.RGBA, error) {
+	digits := strings.TrimPrefix(str, "#")
+	if len(digits) != 6 && len(digits) != 8 {
+		return color.RGBA{}, errors.New("expected 6 or 8 hex digits")
+	}
+
+	channels, err := hex.DecodeString(digits)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+
+	rgba := color.RGBA{R: channels[0], G: channels[1], B: channels[2], A: 0xff}
+	if len(channels) == 4 {
+		rgba.A = channels[3]
+	}
+
+	return rgba, nil
+}
+
+// readGlob backs the `from=glob` tag option by concatenating the contents of every file
+// matching pattern, in sorted order.
+func readGlob(pattern string) ([]byte, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.New("no files match the pattern")
+	}
+
+	slices.Sort(paths)
+	var bundle []byte
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		bundle = append(bundle, data...)
+	}
+
+	return bundle, nil
+}
+
+// nullable detects optional value types like [database/sql.NullString], which pair a
+// `Valid bool` field with a single value field. It returns the value field and the
+// validity field.
+func nullable(val reflect.Value) (reflect.Value, reflect.Value, bool) {
+	structType := val.Type()
+	if structType.Kind() != reflect.Struct || structType.NumField() != 2 {
+		return reflect.Value{}, reflect.Value{}, false
+	}
+
+	validField, ok := structType.FieldByName("Valid")
+	if !ok || validField.Type.Kind() != reflect.Bool {
+		return reflect.Value{}, reflect.Value{}, false
+	}
+
+	innerIdx := 0
+	if validField.Index[0] == 0 {
+		innerIdx = 1
+	}
+
+	if !structType.Field(innerIdx).IsExported() {
+		return reflect.Value{}, reflect.Value{}, false
+	}
+
+	return val.Field(innerIdx), val.Field(validField.Index[0]), true
+}
+
+// parseBool parses the friendly boolean values accepted by bool fields.
+func parseBool(str string) (bool, bool) {
+	switch strings.ToLower(str) {
+	case "true", "t", "yes", "1", "on":
+		return true, true
+	case "", "false", "f", "no", "0", "off":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// intBase returns the base to parse the integer str in. Integers prefixed by 0x, 0o or
+// 0b are parsed as hex, octal or binary respectively by returning 0, which leaves the
+// prefix to [strconv.ParseInt]. Anything else is decimal, so a leading zero doesn't make
+// an integer octal.
+func intBase(str string) int {
+	digits := strings.TrimLeft(str, "+-")
+	if len(digits) < 2 || digits[0] != '0' {
+		return 10
+	}
+
+	switch digits[1] {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return 0
+	default:
+		return 10
+	}
+}
+
+// checkStrictNum backs the `strictnum` tag option by rejecting numbers written with a
+// leading plus sign or superfluous leading zeros, which are otherwise accepted.
+func checkStrictNum(str string) error {
+	if strings.HasPrefix(str, "+") {
+		return errors.New("leading plus sign is not allowed")
+	}
+
+	digits := strings.TrimPrefix(str, "-")
+	if intBase(digits) != 10 {
+		return nil
+	}
+
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return errors.New("leading zeros are not allowed")
+	}
+
+	return nil
+}
+
+// coerceSlice splits a comma delimited list and coerces each element into a new slice
+// assigned to val. Values wrapped in brackets are parsed as JSON arrays instead, e.g.
+// [8080,8081] or ["a,b","c"].
+func coerceSlice(b *binding, val reflect.Value, str string) error {
+	var elems []string
+	switch {
+	case strings.HasPrefix(str, "[") && strings.HasSuffix(str, "]"):
+		var err error
+		elems, err = splitJSONArray(str)
+		if err != nil {
+			return fmt.Errorf("could not assign %q to slice %q: %w", str, b.field.Name, err)
+		}
+	case str != "":
+		elems = strings.Split(str, ",")
+	}
+
+	slice := reflect.MakeSlice(val.Type(), len(elems), len(elems))
+	for i, elem := range elems {
+		if err := coerceValue(b, slice.Index(i), strings.TrimSpace(elem)); err != nil {
+			return fmt.Errorf("could not assign index %d of slice %q: %w", i, b.field.Name, err)
+		}
+	}
+
+	val.Set(slice)
+	return nil
+}
+
+// coerceMap parses a comma delimited list of key:value pairs, e.g. a:1,b:2, coercing
+// each key and value into a new map assigned to val. Sets, maps with struct{} values,
+// are parsed from a plain comma delimited list of keys instead, e.g. a,b. Maps with the
+// `json` option are decoded from a JSON object instead.
+func coerceMap(b *binding, val reflect.Value, str string) error {
+	mapType := val.Type()
+	if b.opts.has("json") {
+		m := reflect.New(mapType)
+		if err := json.Unmarshal([]byte(str), m.Interface()); err != nil {
+			return fmt.Errorf("could not assign %q to map %q: %w", str, b.field.Name, err)
+		}
+
+		val.Set(m.Elem())
+		return nil
+	}
+
+	m := reflect.MakeMap(mapType)
+	if isSet(mapType) {
+		elems := reflect.New(reflect.SliceOf(mapType.Key())).Elem()
+		if err := coerceSlice(b, elems, str); err != nil {
+			return err
+		}
+
+		member := reflect.New(mapType.Elem()).Elem()
+		for i := range elems.Len() {
+			m.SetMapIndex(elems.Index(i), member)
+		}
+
+		val.Set(m)
+		return nil
+	}
+
+	if str != "" {
+		for _, pair := range strings.Split(str, ",") {
+			keyStr, elemStr, found := strings.Cut(pair, ":")
+			keyStr = strings.TrimSpace(keyStr)
+			if !found {
+				return fmt.Errorf(
+					"could not assign %q to map %q: missing ':' in %q",
+					str,
+					b.field.Name,
+					pair,
+				)
+			}
+
+			key := reflect.New(mapType.Key()).Elem()
+			if err := coerceValue(b, key, keyStr); err != nil {
+				return fmt.Errorf("could not assign key %q of map %q: %w", keyStr, b.field.Name, err)
+			}
+
+			elem := reflect.New(mapType.Elem()).Elem()
+			if err := coerceValue(b, elem, strings.TrimSpace(elemStr)); err != nil {
+				return fmt.Errorf("could not assign key %q of map %q: %w", keyStr, b.field.Name, err)
+			}
+
+			m.SetMapIndex(key, elem)
+		}
+	}
+
+	val.Set(m)
+	return nil
+}
+
+// isSet reports whether mapType is used as a set, i.e. it has struct{} values.
+func isSet(mapType reflect.Type) bool {
+	elemType := mapType.Elem()
+	return elemType.Kind() == reflect.Struct && elemType.NumField() == 0
+}
+
+// splitJSONArray returns the elements of a JSON array as strings that can be coerced.
+// String elements are unquoted while any other element is kept as written.
+func splitJSONArray(str string) ([]string, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal([]byte(str), &raws); err != nil {
+		return nil, err
+	}
+
+	elems := make([]string, len(raws))
+	for i, raw := range raws {
+		if !bytes.HasPrefix(raw, []byte(`"`)) {
+			elems[i] = string(raw)
+			continue
+		}
+
+		if err := json.Unmarshal(raw, &elems[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return elems, nil
+}
+
+// formatValue is the inverse of [coerceValue], rendering val as a string that can be
+// coerced back into the same value.
+func formatValue(b *binding, val reflect.Value) string {
+	if val.Type() == durationType {
+		return time.Duration(val.Int()).String()
+	}
+
+	if val.Type() == regexpType {
+		if val.IsNil() {
+			return ""
+		}
+
+		return val.Interface().(*regexp.Regexp).String()
+	}
+
+	if val.Type() == locationType {
+		if val.IsNil() {
+			return ""
+		}
+
+		return val.Interface().(*time.Location).String()
+	}
+
+	if val.Type() == tcpAddrType || val.Type() == udpAddrType {
+		if val.IsNil() {
+			return ""
+		}
+
+		return val.Interface().(net.Addr).String()
+	}
+
+	if val.Type() == certificateType {
+		if val.IsNil() {
+			return ""
+		}
+
+		return formatPEM("CERTIFICATE", val.Interface().(*x509.Certificate).Raw)
+	}
+
+	if val.Type() == keyPairType {
+		keyPair := val.Interface().(tls.Certificate)
+		var blocks []string
+		for _, cert := range keyPair.Certificate {
+			blocks = append(blocks, formatPEM("CERTIFICATE", cert))
+		}
+
+		if key, err := x509.MarshalPKCS8PrivateKey(keyPair.PrivateKey); err == nil {
+			blocks = append(blocks, formatPEM("PRIVATE KEY", key))
+		}
+		return strings.Join(blocks, "\n")
+	}
+
+	if slices.Contains(atomicTypes, val.Type()) && val.CanAddr() {
+		return formatValue(b, val.Addr().MethodByName("Load").Call(nil)[0])
+	}
+
+	if val.Type() == colorType {
+		rgba := val.Interface().(color.RGBA)
+		if rgba.A == 0xff {
+			return fmt.Sprintf("#%02x%02x%02x", rgba.R, rgba.G, rgba.B)
+		}
+
+		return fmt.Sprintf("#%02x%02x%02x%02x", rgba.R, rgba.G, rgba.B, rgba.A)
+	}
+
+	if val.Kind() != reflect.Pointer && val.CanAddr() {
+		// values like big.Rat only marshal through a pointer
+		if reflect.PointerTo(val.Type()).Implements(textMarshalerType) {
+			val = val.Addr()
+		}
+	}
+
+	if val.Type().Implements(textMarshalerType) {
+		if val.Kind() == reflect.Pointer && val.IsNil() {
+			return ""
+		}
+
+		if text, err := val.Interface().(encoding.TextMarshaler).MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+
+	switch val.Kind() {
+	case reflect.String:
+		return val.String()
+	case reflect.Bool:
+		return strconv.FormatBool(val.Bool() != b.opts.has("negate"))
+	case reflect.Slice:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return string(val.Bytes())
+		}
+
+		if b.opts.has("runes") && val.Type().Elem().Kind() == reflect.Int32 {
+			return string(val.Convert(reflect.TypeFor[[]rune]()).Interface().([]rune))
+		}
+
+		elems := make([]string, val.Len())
+		for i := range val.Len() {
+			elems[i] = formatValue(b, val.Index(i))
+		}
+		return strings.Join(elems, ",")
+	case reflect.Map:
+		if b.opts.has("json") && val.CanInterface() {
+			if encoded, err := json.Marshal(val.Interface()); err == nil {
+				return string(encoded)
+			}
+		}
+
+		pairs := make([]string, 0, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			if isSet(val.Type()) {
+				pairs = append(pairs, formatValue(b, iter.Key()))
+				continue
+			}
+
+			pairs = append(pairs, formatValue(b, iter.Key())+":"+formatValue(b, iter.Value()))
+		}
+
+		slices.Sort(pairs)
+		return strings.Join(pairs, ",")
+	case reflect.Struct:
+		if inner, valid, ok := nullable(val); ok {
+			if !valid.Bool() {
+				return ""
+			}
+
+			return formatValue(b, inner)
+		}
+
+		return fmt.Sprint(val.Interface())
+	default:
+		return fmt.Sprint(val.Interface())
+	}
+}
+
+// formatPEM encodes der as a PEM block without a trailing line break.
+func formatPEM(blockType string, der []byte) string {
+	block := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	return strings.TrimSuffix(string(block), "\n")
+}
@@ -1,13 +1,16 @@
 package confetti
 
 import (
-	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"maps"
+	"net/url"
 	"os"
 	"reflect"
-	"strconv"
+	"slices"
 	"strings"
 )
 
@@ -26,94 +29,331 @@ func FromFiles[T any](paths ...string) (T, error) {
 
 // ApplyEnv attempts to coerce matching environment variables into struct fields. It
 // matches using the `conf` struct field tag if present, falling back to the struct
-// field name otherwise.
-func ApplyEnv(target any) error {
-	targetType, targetVal, err := getTarget(target)
+// field name otherwise. A renamed key can keep accepting its old name with the
+// `deprecated` tag option, e.g. `conf:"NEW_NAME,deprecated=OLD_NAME"`. The new name
+// always wins if both are set. Map fields with the `capture` option collect every
+// variable prefixed by their key, e.g. `conf:"FEATURE_,capture"` maps FEATURE_SEARCH=on
+// to {"SEARCH": "on"}. The `match` option collects variables matching a regular
+// expression instead, keyed by what's left once the match is removed, e.g.
+// `conf:"FLAGS,match=^FLAG_"`. Patterns can't contain commas. Bool fields with the
+// `presence` option are true whenever their variable is set, even to an empty string or
+// 0, and likewise whenever their key appears in a file. Options that affect how the
+// environment is read, like [WithInterpolation] and [WithNameMapper], apply the same way
+// as they do for [Load].
+//
+// Other tag options adjust how values are coerced, whichever source they come from:
+//
+//   - runes: []rune fields hold the value as a string of runes. Without it they're parsed
+//     as a comma delimited list of int32s, since rune is an alias of int32.
+//   - allowNonFinite: float fields accept Inf, +Inf, -Inf and NaN. Without it those values
+//     are rejected, since they're rarely what was meant.
+//   - grouped: integer fields ignore commas and underscores used to group digits, e.g.
+//     1,000,000 or 1_000_000.
+//   - negate: bool fields hold the opposite of their value, for keys with the opposite
+//     meaning, e.g. `conf:"DISABLE_CACHE,negate"` on a CacheEnabled field.
+//   - strictnum: numeric fields reject a leading plus sign and leading zeros, e.g. +8080
+//     or 08080, which are otherwise accepted.
+//   - unit: duration fields accept bare numbers in the given unit, e.g. with
+//     `conf:"TIMEOUT,unit=s"` TIMEOUT=30 means 30s. Without it bare numbers are rejected,
+//     since there's no telling which unit was meant.
+//   - from=glob: []byte fields treat the value as a glob pattern and hold the contents of
+//     every matching file concatenated in lexical order, e.g. `conf:"CA_BUNDLE,from=glob"`.
+//     Any file readable by the process can be read this way, so only use it with config
+//     sources that are trusted.
+//   - nonneg: int, float and duration fields reject negative values.
+//   - merge=append: once a slice field has been set, later values for its key are
+//     appended rather than replacing it. That includes a key repeated within one file, a
+//     key set by several files, and the environment following files in [Load].
+//   - json: map fields are decoded from a JSON object, e.g. {"a": 1}, rather than a comma
+//     delimited list of key:value pairs, so their values can be structs or nested maps.
+func ApplyEnv(target any, opts ...Option) error {
+	l, err := newLoader(target, newOptions(opts...))
 	if err != nil {
 		return err
 	}
 
-	targetName := targetType.Name()
-	for i := range targetType.NumField() {
-		field := targetType.Field(i)
+	return l.hooked(l.applyEnv)
+}
+
+// ApplyFiles reads .env formatted files and attempts to apply them to the given target.
+// Files are applied in order with the latter taking precedence. It matches on keys using
+// the `conf` struct field tag if present, falling back to the struct field name
+// otherwise. Java-style .properties keys containing dots are translated to nested keys,
+// so db.host matches the HOST field of a struct field tagged `conf:"DB"`. A file may be
+// split into sections by lines containing only `---`, which are applied in order as if
+// they were separate files. Lines starting with # are comments, as is anything after a
+// # preceded by whitespace unless it's quoted, e.g. PORT=8080 # the http port. Values
+// wrapped in single or double quotes have the quotes stripped. Errors applying a file
+// name the file they originated from. The tag options listed for [ApplyEnv] apply to
+// values read from files too. Fields with the `raw` tag option receive values exactly as
+// written after the =, with surrounding whitespace, quotes and trailing comments kept,
+// e.g. `conf:"GREETING,raw"`.
+func ApplyFiles(target any, paths ...string) error {
+	return ApplyFS(target, osFS{}, paths...)
+}
 
-		confKey := field.Tag.Get("conf")
-		if confKey == "" {
-			confKey = field.Name
+// ApplyNamespace behaves like [ApplyFiles] but only applies keys prefixed by ns and an
+// underscore, stripping the prefix before matching. This allows a single file to hold
+// the config of several services, e.g. the key API_PORT applies to the PORT field when
+// ns is API while WORKER_PORT is ignored.
+func ApplyNamespace(target any, ns string, paths ...string) error {
+	l, err := newLoader(target, newOptions())
+	if err != nil {
+		return err
+	}
+
+	l.namespace = ns + "_"
+	return l.hooked(func() error {
+		for _, path := range paths {
+			if err := l.applyFile(osFS{}, path); err != nil {
+				return err
+			}
 		}
 
-		val := os.Getenv(confKey)
-		if val == "" {
+		return nil
+	})
+}
+
+// ApplyFirstFile applies only the first of the given paths that exists and can be
+// read, ignoring the rest, much like resolving a command on the shell's PATH. It
+// returns an error wrapping [fs.ErrNotExist] if none of them can be read.
+func ApplyFirstFile(target any, paths ...string) error {
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
 			continue
 		}
+		file.Close()
 
-		if err := coerceValue(field, targetVal.Field(i), val); err != nil {
-			return fmt.Errorf("applying env to %q: %w", targetName, err)
-		}
+		return ApplyFiles(target, path)
 	}
 
-	return nil
+	return fmt.Errorf("parsing config file: none of %q could be read: %w", paths, fs.ErrNotExist)
 }
 
-// ApplyFiles reads .env formatted files and attempts to apply them to the given target.
-// Files are applied in order with the latter taking precedence. It matches on keys using
-// the `conf` struct field tag if present, falling back to the struct field name
-// otherwise.
-func ApplyFiles(target any, paths ...string) error {
-	for _, path := range paths {
-		if err := applyFile(target, path); err != nil {
-			return err
+// ApplyFilesIf behaves like [ApplyFiles] but only applies the files when the guard
+// environment variable is set to a truthy value like "true", "yes", or "1". This makes
+// it easy to gate optional blocks of config behind a feature flag.
+func ApplyFilesIf(guard string, target any, paths ...string) error {
+	val, ok := os.LookupEnv(guard)
+	if !ok {
+		return nil
+	}
+
+	enabled, ok := parseBool(val)
+	if !ok {
+		return fmt.Errorf("could not parse guard %q: %q is not a bool", guard, val)
+	}
+
+	if !enabled {
+		return nil
+	}
+
+	return ApplyFiles(target, paths...)
+}
+
+// ApplyReader reads .env formatted config from r and attempts to apply it to the given
+// target. It matches on keys the same way as [ApplyFiles].
+func ApplyReader(target any, r io.Reader) error {
+	l, err := newLoader(target, newOptions())
+	if err != nil {
+		return err
+	}
+
+	return l.hooked(func() error {
+		return l.applyReader(r)
+	})
+}
+
+// ApplyStdin reads .env formatted config from [os.Stdin] the same way as [ApplyReader],
+// so config can be piped in, e.g. cat config.env | myapp.
+func ApplyStdin(target any) error {
+	return ApplyReader(target, os.Stdin)
+}
+
+// ApplyINI reads an INI file and attempts to apply it to the given target. Keys beneath
+// a [section] header are nested under the section, so host in a [database] section
+// matches the HOST field of a struct field tagged `conf:"DATABASE"`. Like dotted keys,
+// sectioned keys are upper cased before matching. Lines starting with ; are comments in
+// addition to those starting with #. Otherwise the file is parsed the same way as
+// [ApplyFiles].
+func ApplyINI(target any, path string) error {
+	l, err := newLoader(target, newOptions())
+	if err != nil {
+		return err
+	}
+
+	l.sections = true
+	return l.hooked(func() error {
+		return l.applyFile(osFS{}, path)
+	})
+}
+
+// ApplyKeyVal applies a single key/value pair to the given target, matching and coercing
+// it the same way as [ApplyFiles]. This makes it possible to build parsers for other
+// config formats on top of confetti. Keys that don't match any field are ignored. Since
+// it's called once per key, the BeforeApply and AfterApply hooks aren't run, though
+// panics are still recovered and returned as errors.
+func ApplyKeyVal(target any, key, value string) error {
+	l, err := newLoader(target, newOptions())
+	if err != nil {
+		return err
+	}
+
+	return l.recovered(func() error {
+		return l.applyKeyVal(key, value)
+	})
+}
+
+// Merge applies the keys present in m to the given target, matching them the same way
+// as [ApplyFiles]. Only fields matched by a key in m are set; every other field keeps
+// its current value, even if it's the zero value, and defaults are not applied. This
+// makes it suitable for applying partial updates delivered over time.
+func Merge(target any, m map[string]string) error {
+	l, err := newLoader(target, newOptions())
+	if err != nil {
+		return err
+	}
+
+	l.source = sourceMap
+	return l.hooked(func() error {
+		for _, key := range slices.Sorted(maps.Keys(m)) {
+			if err := l.applyKeyVal(key, m[key]); err != nil {
+				return err
+			}
 		}
+
+		return nil
+	})
+}
+
+// MergeSeparated behaves like [Merge] but translates keys delimited by sep into nested
+// keys the same way dotted keys are translated by [ApplyFiles]. This suits flat key/value
+// snapshots from stores like Consul or etcd, e.g. with a sep of "/" the key
+// service/db/host configures the HOST field of a struct field tagged `conf:"DB"` nested
+// in a struct field tagged `conf:"SERVICE"`. sep must not be empty.
+func MergeSeparated(target any, m map[string]string, sep string) error {
+	if sep == "" {
+		return errors.New("merging separated keys: sep must not be empty")
 	}
 
-	return nil
+	nested := make(map[string]string, len(m))
+	for key, val := range m {
+		nested[strings.ToUpper(strings.ReplaceAll(key, sep, "_"))] = val
+	}
+
+	return Merge(target, nested)
 }
 
-func applyFile(target any, path string) error {
-	file, err := os.OpenFile(path, os.O_RDONLY, 0)
+// ApplyMapRemainder behaves like [Merge] but returns the entries of m that don't match
+// any field, so they can be passed on elsewhere.
+func ApplyMapRemainder(target any, m map[string]string) (map[string]string, error) {
+	l, err := newLoader(target, newOptions())
 	if err != nil {
-		return fmt.Errorf("parsing config file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	r := bufio.NewReader(file)
-	var done bool
-	for !done {
-		line, err := r.ReadBytes('\n')
-		if err != nil {
-			if err != io.EOF {
-				return fmt.Errorf("reading config file: %w", err)
+	l.source = sourceMap
+	leftover := make(map[string]string)
+	err = l.hooked(func() error {
+		for _, key := range slices.Sorted(maps.Keys(m)) {
+			warned := len(l.warnings)
+			if err := l.applyKeyVal(key, m[key]); err != nil {
+				return err
 			}
 
-			done = true
+			if len(l.warnings) > warned && l.warnings[warned].Kind == WarningUnmatchedKey {
+				leftover[key] = m[key]
+			}
 		}
 
-		key, val, found := strings.Cut(string(line), "=")
-		if !found {
-			// skip lines with bogus config values
-			continue
-		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return leftover, nil
+}
+
+// ApplyValues applies query parameters or form values to the given target, matching
+// keys the same way as [ApplyFiles]. The first value of each key is used, except for
+// slice fields which are populated by every value when a key is repeated, e.g.
+// ?host=a&host=b sets a []string field keyed host to [a b].
+func ApplyValues(target any, v url.Values) error {
+	l, err := newLoader(target, newOptions())
+	if err != nil {
+		return err
+	}
+
+	l.source = sourceValues
+	return l.hooked(func() error {
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			vals := v[key]
+			if len(vals) == 0 {
+				continue
+			}
+
+			val := vals[0]
+			if len(vals) > 1 && l.matchesSlice(key) {
+				// JSON arrays are split without mangling values containing commas
+				encoded, err := json.Marshal(vals)
+				if err != nil {
+					return err
+				}
+				val = string(encoded)
+			}
 
-		if err := applyKeyVal(
-			target,
-			strings.Trim(key, " \t\n"),
-			strings.Trim(val, " \t\n"),
-		); err != nil {
-			return fmt.Errorf("applying %q: %w", path, err)
+			if err := l.applyKeyVal(key, val); err != nil {
+				return err
+			}
 		}
+
+		return nil
+	})
+}
+
+// ApplyFS behaves like [ApplyFiles] but opens each path through fsys instead of the
+// real filesystem. This makes it possible to load config bundled with [embed.FS].
+func ApplyFS(target any, fsys fs.FS, paths ...string) error {
+	l, err := newLoader(target, newOptions())
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return l.hooked(func() error {
+		for _, path := range paths {
+			if err := l.applyFile(fsys, path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// osFS opens files directly from the real filesystem. Unlike [os.DirFS] it accepts
+// both relative and absolute paths.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
 }
 
 func getTarget(target any) (reflect.Type, reflect.Value, error) {
 	ptrType := reflect.TypeOf(target)
-	if ptrType.Kind() != reflect.Pointer {
+	if ptrType == nil || ptrType.Kind() != reflect.Pointer {
 		return nil,
 			reflect.Value{},
 			errors.New("confetti can only parse into pointer types")
 	}
 
+	if reflect.ValueOf(target).IsNil() {
+		return nil,
+			reflect.Value{},
+			errors.New("confetti can't parse into a nil pointer")
+	}
+
 	targetType := ptrType.Elem()
 	if targetType.Kind() != reflect.Struct {
 		return nil,
@@ -124,69 +364,56 @@ func getTarget(target any) (reflect.Type, reflect.Value, error) {
 	return targetType, reflect.ValueOf(target).Elem(), nil
 }
 
-func coerceValue(field reflect.StructField, val reflect.Value, str string) error {
-	switch field.Type.Kind() {
-	case reflect.String:
-		val.SetString(str)
-	case reflect.Bool:
-		switch strings.ToLower(str) {
-		case "true", "t", "yes", "1", "on":
-			val.SetBool(true)
-		case "", "false", "f", "no", "0", "off":
-			val.SetBool(false)
-		default:
-			return fmt.Errorf("could not assign %q to bool %q", str, field.Name)
-		}
-	case reflect.Int:
-		intVal, err := strconv.Atoi(str)
-		if err != nil {
-			return fmt.Errorf("could not assign %q to int %q: %w", str, field.Name, err)
-		}
-		val.SetInt(int64(intVal))
-	case reflect.Uint:
-		uintVal, err := strconv.ParseInt(str, 10, 32)
-		if err != nil {
-			return fmt.Errorf("could not assign %q to uint %q: %w", str, field.Name, err)
-		}
-		val.SetUint(uint64(uintVal))
-	case reflect.Slice:
-		if field.Type.Elem().Kind() == reflect.Uint8 {
-			val.Set(reflect.ValueOf([]byte(str)))
-			break
-		}
-
-		return fmt.Errorf(
-			"could not assign %q to slice %q: only byte slices are supported",
-			str,
-			field.Name,
-		)
-	}
+// tagOptions holds the options trailing the key in a `conf` struct tag, e.g.
+// `conf:"RATE,allowNonFinite"`. Options without a value map to an empty string. The
+// `default` option must come last since its value runs to the end of the tag, which
+// allows defaults to contain commas.
+type tagOptions map[string]string
 
-	return nil
+func (o tagOptions) has(name string) bool {
+	_, ok := o[name]
+	return ok
 }
 
-func applyKeyVal(target any, key, value string) error {
-	targetType, targetVal, err := getTarget(target)
-	if err != nil {
-		return err
+// parseTag returns the config key for the given field along with any tag options. The
+// first of the given tag names present on the field is used, defaulting to `conf`. The
+// key falls back to the struct field name if the tag doesn't provide one, which is
+// reported by the final return value being false.
+func parseTag(field reflect.StructField, tagNames ...string) (string, tagOptions, bool) {
+	if len(tagNames) == 0 {
+		tagNames = []string{"conf"}
+	}
+
+	var tag string
+	for _, name := range tagNames {
+		if value, ok := field.Tag.Lookup(name); ok {
+			tag = value
+			break
+		}
 	}
 
-	targetName := targetType.Name()
-	for i := range targetType.NumField() {
-		field := targetType.Field(i)
+	key, rest, _ := strings.Cut(tag, ",")
+	tagged := key != ""
+	if !tagged {
+		key = field.Name
+	}
 
-		confKey := field.Tag.Get("conf")
-		if confKey == "" {
-			confKey = field.Name
+	opts := tagOptions{}
+	for rest != "" {
+		var opt string
+		if strings.HasPrefix(rest, "default=") {
+			opt, rest = rest, ""
+		} else {
+			opt, rest, _ = strings.Cut(rest, ",")
 		}
 
-		if confKey == key {
-			fieldVal := targetVal.Field(i)
-			if err := coerceValue(field, fieldVal, value); err != nil {
-				return fmt.Errorf("applying config to %q: %w", targetName, err)
-			}
+		if opt == "" {
+			continue
 		}
+
+		name, val, _ := strings.Cut(opt, "=")
+		opts[name] = val
 	}
 
-	return nil
+	return key, opts, tagged
 }
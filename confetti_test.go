@@ -1,9 +1,38 @@
 package confetti_test
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
+	"unicode/utf16"
 
 	"github.com/eriktate/confetti"
 	"github.com/stretchr/testify/require"
@@ -127,3 +156,1666 @@ DefaultKey=default`
 	require.Equal(t, []byte("bytes"), cfg.ByteSlice)
 	require.Equal(t, "default", cfg.DefaultKey)
 }
+
+func TestApplyReader(t *testing.T) {
+	content := `TEST_NAME=test
+TEST_INT=-42
+DefaultKey=default`
+
+	cfg := testConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, "test", cfg.String)
+	require.Equal(t, -42, cfg.Int)
+	require.Equal(t, "default", cfg.DefaultKey)
+}
+
+func TestApplyComments(t *testing.T) {
+	type commentConfig struct {
+		Port   int    `conf:"PORT"`
+		Name   string `conf:"NAME"`
+		Quoted string `conf:"QUOTED"`
+		Single string `conf:"SINGLE"`
+		Color  string `conf:"COLOR"`
+		URL    string `conf:"URL"`
+	}
+
+	content := `# the http port
+PORT=8080 # inline comment
+  #NAME=commented
+NAME=name	# after a tab
+QUOTED="value # not a comment" # a comment
+SINGLE='# hash' # comment
+COLOR=#fff
+URL=http://host/#anchor`
+
+	cfg := commentConfig{}
+	warnings, err := confetti.LoadInto(&cfg, confetti.WithFiles(writeFile(t, ".env", content)))
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	require.Equal(t, 8080, cfg.Port)
+	require.Equal(t, "name", cfg.Name)
+	require.Equal(t, "value # not a comment", cfg.Quoted)
+	require.Equal(t, "# hash", cfg.Single)
+	require.Equal(t, "#fff", cfg.Color)
+	require.Equal(t, "http://host/#anchor", cfg.URL)
+}
+
+func TestApplySections(t *testing.T) {
+	content := `TEST_NAME=base
+TEST_INT=1
+---
+TEST_NAME=override
+---
+DefaultKey=default`
+
+	cfg := testConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, "override", cfg.String)
+	require.Equal(t, 1, cfg.Int)
+	require.Equal(t, "default", cfg.DefaultKey)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_NAME<<EOF\nscript\n---\nTEST_INT=2\nEOF"))
+	require.ErrorContains(t, err, "section ended before closing marker")
+}
+
+func TestApplyFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config/.env": &fstest.MapFile{Data: []byte(`TEST_NAME=test
+TEST_BOOL=true
+TEST_INT=-42
+TEST_UINT=10`)},
+		"config/.secret": &fstest.MapFile{Data: []byte(`TEST_UINT=42
+TEST_BYTE_SLICE=bytes
+DefaultKey=default`)},
+	}
+
+	cfg := testConfig{}
+	err := confetti.ApplyFS(&cfg, fsys, "config/.env", "config/.secret")
+	require.NoError(t, err)
+
+	require.Equal(t, "test", cfg.String)
+	require.Equal(t, true, cfg.Bool)
+	require.Equal(t, -42, cfg.Int)
+	require.Equal(t, uint(42), cfg.Uint)
+	require.Equal(t, []byte("bytes"), cfg.ByteSlice)
+	require.Equal(t, "default", cfg.DefaultKey)
+
+	err = confetti.ApplyFS(&cfg, fsys, "config/.missing")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestApplyFloats(t *testing.T) {
+	type floatConfig struct {
+		Float64   float64 `conf:"TEST_FLOAT64"`
+		Float32   float32 `conf:"TEST_FLOAT32"`
+		NonFinite float64 `conf:"TEST_NON_FINITE,allowNonFinite"`
+	}
+
+	valid := map[string]float64{
+		"-1.5":    -1.5,
+		"1e3":     1000,
+		"-2.5E-2": -0.025,
+		"+.5":     0.5,
+	}
+	for str, expected := range valid {
+		cfg := floatConfig{}
+		err := confetti.ApplyReader(&cfg, strings.NewReader("TEST_FLOAT64="+str))
+		require.NoError(t, err)
+		require.Equal(t, expected, cfg.Float64)
+	}
+
+	cfg := floatConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("TEST_FLOAT32=0.25"))
+	require.NoError(t, err)
+	require.Equal(t, float32(0.25), cfg.Float32)
+
+	for _, str := range []string{"Inf", "-Inf", "NaN"} {
+		cfg := floatConfig{}
+		err := confetti.ApplyReader(&cfg, strings.NewReader("TEST_FLOAT64="+str))
+		require.Error(t, err)
+		require.Zero(t, cfg.Float64)
+
+		err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_NON_FINITE="+str))
+		require.NoError(t, err)
+	}
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_NON_FINITE=-Inf"))
+	require.NoError(t, err)
+	require.True(t, math.IsInf(cfg.NonFinite, -1))
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_NON_FINITE=NaN"))
+	require.NoError(t, err)
+	require.True(t, math.IsNaN(cfg.NonFinite))
+
+	// overflowing float32 is a range error rather than silently becoming Inf
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_FLOAT32=1e39"))
+	require.Error(t, err)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_FLOAT64=abc"))
+	require.Error(t, err)
+}
+
+func TestApplyHeredoc(t *testing.T) {
+	content := `TEST_INT=42
+TEST_NAME<<EOF
+#!/bin/sh
+  echo "key=value"
+
+	exit 0
+EOF
+DefaultKey=default`
+
+	cfg := testConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, "#!/bin/sh\n  echo \"key=value\"\n\n\texit 0", cfg.String)
+	require.Equal(t, 42, cfg.Int)
+	require.Equal(t, "default", cfg.DefaultKey)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_NAME<<EOF\nunterminated"))
+	require.Error(t, err)
+
+	type certConfig struct {
+		Cert string `conf:"DB_CERT"`
+		Note string `conf:"NOTE"`
+	}
+
+	certs := certConfig{}
+	err = confetti.ApplyReader(&certs, strings.NewReader("see docs << note\ndb.cert<<EOF\npem\nEOF\nNOTE=set"))
+	require.NoError(t, err)
+	require.Equal(t, certConfig{Cert: "pem", Note: "set"}, certs)
+}
+
+func TestApplyDurations(t *testing.T) {
+	type durationConfig struct {
+		Timeout  time.Duration   `conf:"TEST_TIMEOUT"`
+		Backoffs []time.Duration `conf:"TEST_BACKOFFS"`
+		Ports    []int           `conf:"TEST_PORTS"`
+		Hosts    []string        `conf:"TEST_HOSTS"`
+	}
+
+	content := `TEST_TIMEOUT=1m30s
+TEST_BACKOFFS=1s, 2s,4s
+TEST_PORTS=8080,8081
+TEST_HOSTS=a.com,b.com`
+
+	cfg := durationConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, 90*time.Second, cfg.Timeout)
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, cfg.Backoffs)
+	require.Equal(t, []int{8080, 8081}, cfg.Ports)
+	require.Equal(t, []string{"a.com", "b.com"}, cfg.Hosts)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_TIMEOUT=30"))
+	require.Error(t, err)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_BACKOFFS=1s,soon,4s"))
+	require.ErrorContains(t, err, "index 1")
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, cfg.Backoffs)
+}
+
+func TestApplyDurationUnit(t *testing.T) {
+	type unitConfig struct {
+		Timeout time.Duration   `conf:"UNIT_TIMEOUT,unit=s"`
+		Retries []time.Duration `conf:"UNIT_RETRIES,unit=ms"`
+	}
+
+	cfg := unitConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("UNIT_TIMEOUT=30\nUNIT_RETRIES=100,1.5,2s"))
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, cfg.Timeout)
+	require.Equal(t, []time.Duration{
+		100 * time.Millisecond,
+		1500 * time.Microsecond,
+		2 * time.Second,
+	}, cfg.Retries)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("UNIT_TIMEOUT=500ms"))
+	require.NoError(t, err)
+	require.Equal(t, 500*time.Millisecond, cfg.Timeout)
+}
+
+func TestApplyNonNegative(t *testing.T) {
+	type timeoutConfig struct {
+		Timeout time.Duration `conf:"TIMEOUT,nonneg"`
+		Retries int           `conf:"RETRIES,nonneg"`
+		Ratio   float64       `conf:"RATIO,nonneg"`
+		Offset  int           `conf:"OFFSET"`
+	}
+
+	cfg := timeoutConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("TIMEOUT=1m\nRETRIES=0\nRATIO=0.5\nOFFSET=-3"))
+	require.NoError(t, err)
+	require.Equal(t, timeoutConfig{Timeout: time.Minute, Ratio: 0.5, Offset: -3}, cfg)
+
+	for key, val := range map[string]string{"TIMEOUT": "-5s", "RETRIES": "-1", "RATIO": "-0.1"} {
+		err = confetti.ApplyKeyVal(&cfg, key, val)
+		require.ErrorIs(t, err, confetti.ErrCoercion, key)
+		require.ErrorContains(t, err, "nonneg", key)
+	}
+	require.Equal(t, time.Minute, cfg.Timeout)
+}
+
+func TestApplyCapture(t *testing.T) {
+	type captureConfig struct {
+		Features map[string]string `conf:"CAPTURE_FEATURE_,capture"`
+		Limits   map[string]int    `conf:"CAPTURE_LIMIT_,capture"`
+	}
+
+	t.Setenv("CAPTURE_FEATURE_SEARCH", "on")
+	t.Setenv("CAPTURE_FEATURE_BILLING", "off")
+	t.Setenv("CAPTURE_FEATURE", "excluded")
+	t.Setenv("CAPTURE_OTHER", "excluded")
+
+	cfg := captureConfig{}
+	err := confetti.ApplyEnv(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"SEARCH": "on", "BILLING": "off"}, cfg.Features)
+	require.Nil(t, cfg.Limits)
+
+	content := `CAPTURE_LIMIT_READS=10
+CAPTURE_LIMIT_WRITES=5
+CAPTURE_FEATURE_EXPORT=beta`
+	err = confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"READS": 10, "WRITES": 5}, cfg.Limits)
+	require.Equal(t, "beta", cfg.Features["EXPORT"])
+	require.Len(t, cfg.Features, 3)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("CAPTURE_LIMIT_READS=many"))
+	require.Error(t, err)
+}
+
+func TestApplyGrouped(t *testing.T) {
+	type groupedConfig struct {
+		Max     int   `conf:"TEST_MAX,grouped"`
+		UintMax uint  `conf:"TEST_UINT_MAX,grouped"`
+		Strict  int   `conf:"TEST_STRICT"`
+		Ports   []int `conf:"TEST_PORTS"`
+	}
+
+	for _, str := range []string{"1,000,000", "1_000_000", "1000000"} {
+		cfg := groupedConfig{}
+		err := confetti.ApplyReader(&cfg, strings.NewReader("TEST_MAX="+str+"\nTEST_UINT_MAX="+str))
+		require.NoError(t, err)
+		require.Equal(t, 1000000, cfg.Max)
+		require.Equal(t, uint(1000000), cfg.UintMax)
+	}
+
+	// grouping must be opted into and doesn't interfere with slices
+	cfg := groupedConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("TEST_STRICT=1,000"))
+	require.Error(t, err)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_PORTS=1,000"))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 0}, cfg.Ports)
+}
+
+func TestApplyNullable(t *testing.T) {
+	type nullConfig struct {
+		Name    sql.NullString  `conf:"TEST_NULL_NAME"`
+		Absent  sql.NullString  `conf:"TEST_NULL_ABSENT"`
+		Count   sql.NullInt64   `conf:"TEST_NULL_COUNT"`
+		Small   sql.NullInt16   `conf:"TEST_NULL_SMALL"`
+		Enabled sql.NullBool    `conf:"TEST_NULL_ENABLED"`
+		Ratio   sql.NullFloat64 `conf:"TEST_NULL_RATIO"`
+		Generic sql.Null[int8]  `conf:"TEST_NULL_GENERIC"`
+	}
+
+	content := `TEST_NULL_NAME=test
+TEST_NULL_COUNT=42
+TEST_NULL_SMALL=-7
+TEST_NULL_ENABLED=yes
+TEST_NULL_RATIO=0.5
+TEST_NULL_GENERIC=8`
+
+	cfg := nullConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, sql.NullString{String: "test", Valid: true}, cfg.Name)
+	require.Equal(t, sql.NullString{}, cfg.Absent)
+	require.Equal(t, sql.NullInt64{Int64: 42, Valid: true}, cfg.Count)
+	require.Equal(t, sql.NullInt16{Int16: -7, Valid: true}, cfg.Small)
+	require.Equal(t, sql.NullBool{Bool: true, Valid: true}, cfg.Enabled)
+	require.Equal(t, sql.NullFloat64{Float64: 0.5, Valid: true}, cfg.Ratio)
+	require.Equal(t, sql.Null[int8]{V: 8, Valid: true}, cfg.Generic)
+
+	cfg = nullConfig{}
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_NULL_COUNT=lots"))
+	require.Error(t, err)
+	require.False(t, cfg.Count.Valid)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_NULL_SMALL=40000"))
+	require.Error(t, err)
+}
+
+func TestApplyNegate(t *testing.T) {
+	type negateConfig struct {
+		Enabled bool `conf:"TEST_DISABLE_FEATURE,negate"`
+		Debug   bool `conf:"TEST_DEBUG"`
+	}
+
+	t.Setenv("TEST_DISABLE_FEATURE", "true")
+	t.Setenv("TEST_DEBUG", "true")
+
+	cfg := negateConfig{}
+	err := confetti.ApplyEnv(&cfg)
+	require.NoError(t, err)
+	require.False(t, cfg.Enabled)
+	require.True(t, cfg.Debug)
+
+	t.Setenv("TEST_DISABLE_FEATURE", "off")
+	err = confetti.ApplyEnv(&cfg)
+	require.NoError(t, err)
+	require.True(t, cfg.Enabled)
+
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+	require.Equal(t, "TEST_DISABLE_FEATURE=false\nTEST_DEBUG=true\n", string(out))
+}
+
+func TestApplyStrictNum(t *testing.T) {
+	type strictConfig struct {
+		Int   int     `conf:"TEST_STRICT_INT,strictnum"`
+		Uint  uint16  `conf:"TEST_STRICT_UINT,strictnum"`
+		Float float64 `conf:"TEST_STRICT_FLOAT,strictnum"`
+		Lax   int     `conf:"TEST_LAX_INT"`
+	}
+
+	accepted := map[string]string{
+		"TEST_STRICT_INT":   "-5",
+		"TEST_STRICT_UINT":  "0",
+		"TEST_STRICT_FLOAT": "0.5",
+	}
+	for key, val := range accepted {
+		cfg := strictConfig{}
+		err := confetti.ApplyReader(&cfg, strings.NewReader(key+"="+val))
+		require.NoError(t, err, "%s=%s", key, val)
+	}
+
+	rejected := map[string][]string{
+		"TEST_STRICT_INT":   {"+5", "007", "-007"},
+		"TEST_STRICT_UINT":  {"+5", "00"},
+		"TEST_STRICT_FLOAT": {"+1.5", "01.5"},
+	}
+	for key, vals := range rejected {
+		for _, val := range vals {
+			cfg := strictConfig{}
+			err := confetti.ApplyReader(&cfg, strings.NewReader(key+"="+val))
+			require.Error(t, err, "%s=%s", key, val)
+		}
+	}
+
+	cfg := strictConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("TEST_LAX_INT=+007"))
+	require.NoError(t, err)
+	require.Equal(t, 7, cfg.Lax)
+}
+
+type dbConfig struct {
+	Host string `conf:"HOST"`
+	Port int    `conf:"PORT"`
+}
+
+type Common struct {
+	Debug bool `conf:"TEST_NESTED_DEBUG"`
+}
+
+type nestedConfig struct {
+	Common
+	Name  string   `conf:"TEST_NESTED_NAME"`
+	DB    dbConfig `conf:"DB"`
+	Cache struct {
+		Size int
+	}
+}
+
+func TestApplyNested(t *testing.T) {
+	content := `TEST_NESTED_NAME=test
+TEST_NESTED_DEBUG=true
+DB_HOST=localhost
+DB_PORT=5432
+Cache_Size=64`
+
+	cfg := nestedConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, "test", cfg.Name)
+	require.True(t, cfg.Debug)
+	require.Equal(t, dbConfig{Host: "localhost", Port: 5432}, cfg.DB)
+	require.Equal(t, 64, cfg.Cache.Size)
+
+	t.Setenv("DB_HOST", "db.internal")
+	err = confetti.ApplyEnv(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, "db.internal", cfg.DB.Host)
+}
+
+func TestApplyInline(t *testing.T) {
+	type inlineConfig struct {
+		DB      dbConfig `conf:",inline"`
+		Replica dbConfig `conf:"REPLICA"`
+	}
+
+	content := `HOST=primary
+PORT=5432
+REPLICA_HOST=replica`
+
+	cfg := inlineConfig{}
+	warnings, err := confetti.LoadInto(&cfg, confetti.WithFiles(writeFile(t, "inline.env", content)))
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+	require.Equal(t, "primary", cfg.DB.Host)
+	require.Equal(t, 5432, cfg.DB.Port)
+	require.Equal(t, "replica", cfg.Replica.Host)
+}
+
+type base struct {
+	Host string `conf:"EMB_HOST"`
+	port int
+}
+
+func TestApplyEmbeddedUnexported(t *testing.T) {
+	type embeddingConfig struct {
+		base
+		Name string `conf:"EMB_NAME"`
+	}
+
+	cfg := embeddingConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("EMB_HOST=localhost\nEMB_NAME=test\nport=80"))
+	require.NoError(t, err)
+	require.Equal(t, embeddingConfig{base: base{Host: "localhost"}, Name: "test"}, cfg)
+}
+
+func TestApplyDottedKeys(t *testing.T) {
+	content := `db.host=localhost
+db.port=5432
+cache.size=64`
+
+	cfg := nestedConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, dbConfig{Host: "localhost", Port: 5432}, cfg.DB)
+	// dotted keys are upper cased, so they only match upper cased keys
+	require.Zero(t, cfg.Cache.Size)
+}
+
+func TestApplyRegexp(t *testing.T) {
+	type regexpConfig struct {
+		Filter  *regexp.Regexp   `conf:"TEST_FILTER"`
+		Ignored []*regexp.Regexp `conf:"TEST_IGNORED"`
+	}
+
+	cfg := regexpConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(`TEST_FILTER=^user-\d+$
+TEST_IGNORED=^tmp,\.bak$`))
+	require.NoError(t, err)
+
+	require.NotNil(t, cfg.Filter)
+	require.True(t, cfg.Filter.MatchString("user-42"))
+	require.False(t, cfg.Filter.MatchString("admin-42"))
+	require.Len(t, cfg.Ignored, 2)
+	require.True(t, cfg.Ignored[1].MatchString("config.bak"))
+
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+	require.Equal(t, "TEST_FILTER=^user-\\d+$\nTEST_IGNORED=^tmp,\\.bak$\n", string(out))
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_FILTER=user-(\\d+"))
+	require.ErrorContains(t, err, "regexp")
+}
+
+type Flag bool
+
+func TestApplyNamedBool(t *testing.T) {
+	type flagConfig struct {
+		Enabled  Flag   `conf:"TEST_FLAG_ENABLED"`
+		Disabled Flag   `conf:"TEST_FLAG_DISABLED"`
+		Flags    []Flag `conf:"TEST_FLAGS"`
+	}
+
+	cfg := flagConfig{Disabled: true}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(`TEST_FLAG_ENABLED=1
+TEST_FLAG_DISABLED=0
+TEST_FLAGS=1,0,on`))
+	require.NoError(t, err)
+
+	require.Equal(t, Flag(true), cfg.Enabled)
+	require.Equal(t, Flag(false), cfg.Disabled)
+	require.Equal(t, []Flag{true, false, true}, cfg.Flags)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TEST_FLAG_ENABLED=2"))
+	require.Error(t, err)
+}
+
+func TestApplyFilesIf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(path, []byte("TEST_NAME=guarded"), 0o600))
+
+	cfg := testConfig{}
+	err := confetti.ApplyFilesIf("TEST_GUARD", &cfg, path)
+	require.NoError(t, err)
+	require.Empty(t, cfg.String)
+
+	t.Setenv("TEST_GUARD", "off")
+	err = confetti.ApplyFilesIf("TEST_GUARD", &cfg, path)
+	require.NoError(t, err)
+	require.Empty(t, cfg.String)
+
+	t.Setenv("TEST_GUARD", "yes")
+	err = confetti.ApplyFilesIf("TEST_GUARD", &cfg, path)
+	require.NoError(t, err)
+	require.Equal(t, "guarded", cfg.String)
+
+	t.Setenv("TEST_GUARD", "maybe")
+	err = confetti.ApplyFilesIf("TEST_GUARD", &cfg, path)
+	require.Error(t, err)
+}
+
+func TestApplyUnsupportedKind(t *testing.T) {
+	type unsupportedConfig struct {
+		Name    string          `conf:"TEST_NAME"`
+		Events  chan string     `conf:"TEST_EVENTS"`
+		Handler func()          `conf:"TEST_HANDLER"`
+		Complex complex128      `conf:"TEST_COMPLEX"`
+		Unset   chan<- struct{} `conf:"TEST_UNSET"`
+	}
+
+	cfg := unsupportedConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("TEST_NAME=test"))
+	require.NoError(t, err)
+
+	for _, key := range []string{"TEST_EVENTS", "TEST_HANDLER", "TEST_COMPLEX"} {
+		err := confetti.ApplyReader(&cfg, strings.NewReader(key+"=value"))
+		require.ErrorIs(t, err, confetti.ErrUnsupportedKind)
+	}
+
+	t.Setenv("TEST_EVENTS", "value")
+	err = confetti.ApplyEnv(&cfg)
+	require.ErrorIs(t, err, confetti.ErrUnsupportedKind)
+	require.ErrorContains(t, err, "chan")
+}
+
+func TestApplyJSONArraySlices(t *testing.T) {
+	type arrayConfig struct {
+		Ports []int    `conf:"TEST_PORTS"`
+		Hosts []string `conf:"TEST_HOSTS"`
+	}
+
+	plain := arrayConfig{}
+	err := confetti.ApplyReader(&plain, strings.NewReader("TEST_PORTS=8080,8081\nTEST_HOSTS=a,b"))
+	require.NoError(t, err)
+
+	bracketed := arrayConfig{}
+	err = confetti.ApplyReader(&bracketed, strings.NewReader(`TEST_PORTS=[8080, 8081]
+TEST_HOSTS=["a", "b"]`))
+	require.NoError(t, err)
+
+	require.Equal(t, []int{8080, 8081}, bracketed.Ports)
+	require.Equal(t, []string{"a", "b"}, bracketed.Hosts)
+	require.Equal(t, plain, bracketed)
+
+	// JSON strings may contain the delimiter
+	err = confetti.ApplyReader(&bracketed, strings.NewReader(`TEST_HOSTS=["a,b", "c"]`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a,b", "c"}, bracketed.Hosts)
+
+	err = confetti.ApplyReader(&bracketed, strings.NewReader("TEST_PORTS=[]"))
+	require.NoError(t, err)
+	require.Empty(t, bracketed.Ports)
+
+	err = confetti.ApplyReader(&bracketed, strings.NewReader("TEST_PORTS=[8080,"))
+	require.Error(t, err)
+
+	err = confetti.ApplyReader(&bracketed, strings.NewReader("TEST_PORTS=[8080,]"))
+	require.Error(t, err)
+
+	err = confetti.ApplyReader(&bracketed, strings.NewReader(`TEST_PORTS=["http"]`))
+	require.ErrorContains(t, err, "index 0")
+}
+
+func TestApplyNestedTagPrefix(t *testing.T) {
+	type replicaConfig struct {
+		Host string `conf:"HOST"`
+	}
+
+	type databaseConfig struct {
+		Host    string        `conf:"HOST"`
+		Replica replicaConfig `conf:"REPLICA"`
+	}
+
+	type prefixConfig struct {
+		DB databaseConfig `conf:"DATABASE"`
+	}
+
+	t.Setenv("DATABASE_HOST", "primary")
+	t.Setenv("DATABASE_REPLICA_HOST", "replica")
+	t.Setenv("DB_HOST", "ignored")
+
+	cfg, err := confetti.FromEnv[prefixConfig]()
+	require.NoError(t, err)
+	require.Equal(t, "primary", cfg.DB.Host)
+	require.Equal(t, "replica", cfg.DB.Replica.Host)
+}
+
+func TestApplyNamespace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "services.env")
+	content := `API_HOST=api.local
+API_PORT=8080
+WORKER_HOST=worker.local
+WORKER_PORT=9090
+HOST=global`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	cfg := dbConfig{}
+	err := confetti.ApplyNamespace(&cfg, "API", path)
+	require.NoError(t, err)
+	require.Equal(t, "api.local", cfg.Host)
+	require.Equal(t, 8080, cfg.Port)
+
+	cfg = dbConfig{}
+	err = confetti.ApplyNamespace(&cfg, "WORKER", path)
+	require.NoError(t, err)
+	require.Equal(t, "worker.local", cfg.Host)
+	require.Equal(t, 9090, cfg.Port)
+}
+
+func TestApplyFirstFile(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.env")
+	first := filepath.Join(dir, "first.env")
+	second := filepath.Join(dir, "second.env")
+	require.NoError(t, os.WriteFile(first, []byte("TEST_NAME=first\nTEST_INT=1"), 0o600))
+	require.NoError(t, os.WriteFile(second, []byte("TEST_NAME=second"), 0o600))
+
+	cfg := testConfig{}
+	err := confetti.ApplyFirstFile(&cfg, missing, first, second)
+	require.NoError(t, err)
+	require.Equal(t, "first", cfg.String)
+	require.Equal(t, 1, cfg.Int)
+
+	err = confetti.ApplyFirstFile(&cfg, missing, filepath.Join(dir, "other.env"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	err = confetti.ApplyFirstFile(&cfg)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestApplyTypedMaps(t *testing.T) {
+	type mapConfig struct {
+		Weights  map[string]int     `conf:"WEIGHTS"`
+		Features map[string]bool    `conf:"FEATURES"`
+		Limits   map[string]float64 `conf:"LIMITS"`
+	}
+
+	content := `WEIGHTS=a:1, b:2
+FEATURES=search:on,beta:false
+LIMITS=cpu:0.5`
+
+	cfg := mapConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]int{"a": 1, "b": 2}, cfg.Weights)
+	require.Equal(t, map[string]bool{"search": true, "beta": false}, cfg.Features)
+	require.Equal(t, map[string]float64{"cpu": 0.5}, cfg.Limits)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("WEIGHTS=a:1,b:heavy"))
+	require.ErrorContains(t, err, `key "b"`)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("FEATURES=search"))
+	require.Error(t, err)
+}
+
+func TestApplyFilesErrorPath(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.env")
+	bad := filepath.Join(dir, "bad.env")
+	require.NoError(t, os.WriteFile(good, []byte("TEST_INT=1"), 0o600))
+	require.NoError(t, os.WriteFile(bad, []byte("TEST_NAME=test\nTEST_INT=one"), 0o600))
+
+	cfg := testConfig{}
+	err := confetti.ApplyFiles(&cfg, good, bad)
+	require.ErrorContains(t, err, bad)
+	require.NotContains(t, err.Error(), good)
+	require.ErrorContains(t, err, `could not assign "one" to int "Int"`)
+
+	_, _, err = confetti.Load[testConfig](confetti.WithFiles(good, bad))
+	require.ErrorContains(t, err, bad)
+}
+
+func TestApplyKeyVal(t *testing.T) {
+	cfg := nestedConfig{}
+	pairs := [][2]string{
+		{"TEST_NESTED_NAME", "test"},
+		{"TEST_NESTED_DEBUG", "true"},
+		{"DB_PORT", "5432"},
+		{"UNKNOWN", "ignored"},
+	}
+
+	for _, pair := range pairs {
+		require.NoError(t, confetti.ApplyKeyVal(&cfg, pair[0], pair[1]))
+	}
+
+	require.Equal(t, "test", cfg.Name)
+	require.True(t, cfg.Debug)
+	require.Equal(t, 5432, cfg.DB.Port)
+
+	err := confetti.ApplyKeyVal(&cfg, "DB_PORT", "postgres")
+	require.Error(t, err)
+}
+
+func TestMerge(t *testing.T) {
+	cfg := testConfig{Uint: 7}
+	err := confetti.Merge(&cfg, map[string]string{"TEST_NAME": "first", "TEST_INT": "1"})
+	require.NoError(t, err)
+
+	err = confetti.Merge(&cfg, map[string]string{"TEST_INT": "2", "TEST_BOOL": "true"})
+	require.NoError(t, err)
+
+	require.Equal(t, "first", cfg.String)
+	require.Equal(t, 2, cfg.Int)
+	require.True(t, cfg.Bool)
+	require.Equal(t, uint(7), cfg.Uint)
+
+	err = confetti.Merge(&cfg, map[string]string{"TEST_INT": "two"})
+	require.Error(t, err)
+	require.Equal(t, 2, cfg.Int)
+}
+
+func TestApplyEnvInterpolation(t *testing.T) {
+	type urlConfig struct {
+		URL    string `conf:"INTERP_URL"`
+		Cyclic string `conf:"INTERP_CYCLIC"`
+	}
+
+	t.Setenv("INTERP_URL", "${INTERP_BASE}/api$$")
+	t.Setenv("INTERP_BASE", "http://${INTERP_HOST}:${INTERP_PORT}")
+	t.Setenv("INTERP_HOST", "localhost")
+	t.Setenv("INTERP_CYCLIC", "a${INTERP_LOOP}")
+	t.Setenv("INTERP_LOOP", "b${INTERP_CYCLIC}")
+
+	cfg := urlConfig{}
+	err := confetti.ApplyEnv(&cfg, confetti.WithInterpolation())
+	require.NoError(t, err)
+
+	require.Equal(t, "http://localhost:/api$", cfg.URL)
+	require.Equal(t, "ab", cfg.Cyclic)
+
+	cfg = urlConfig{}
+	err = confetti.ApplyEnv(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, "${INTERP_BASE}/api$$", cfg.URL)
+}
+
+func TestRegisterCoercer(t *testing.T) {
+	confetti.RegisterCoercer(reflect.TypeFor[time.Location](), func(val reflect.Value, str string) error {
+		loc, err := time.LoadLocation(str)
+		if err != nil {
+			return err
+		}
+
+		val.Set(reflect.ValueOf(*loc))
+		return nil
+	})
+
+	type zoneConfig struct {
+		Zone time.Location `conf:"ZONE"`
+	}
+
+	cfg := zoneConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("ZONE=UTC"))
+	require.NoError(t, err)
+	require.Equal(t, "UTC", cfg.Zone.String())
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("ZONE=Not/A_Zone"))
+	require.ErrorContains(t, err, `could not assign "Not/A_Zone" to "Zone"`)
+}
+
+// selfSignedPEM generates a self-signed certificate, returning the PEM encoded
+// certificate and private key.
+func selfSignedPEM(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "confetti.test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
+
+func TestApplyCertificates(t *testing.T) {
+	type tlsConfig struct {
+		CA      *x509.Certificate `conf:"TLS_CA"`
+		KeyPair tls.Certificate   `conf:"TLS_KEY_PAIR"`
+	}
+
+	certPEM, keyPEM := selfSignedPEM(t)
+	t.Setenv("TLS_CA", certPEM)
+	t.Setenv("TLS_KEY_PAIR", certPEM+keyPEM)
+
+	cfg := tlsConfig{}
+	err := confetti.ApplyEnv(&cfg)
+	require.NoError(t, err)
+
+	require.Equal(t, "confetti.test", cfg.CA.Subject.CommonName)
+	require.Len(t, cfg.KeyPair.Certificate, 1)
+	require.Equal(t, cfg.CA.Raw, cfg.KeyPair.Certificate[0])
+	require.NotNil(t, cfg.KeyPair.PrivateKey)
+
+	t.Setenv("TLS_KEY_PAIR", certPEM)
+	err = confetti.ApplyEnv(&cfg)
+	require.ErrorContains(t, err, "key pair")
+
+	t.Setenv("TLS_CA", "not a certificate")
+	err = confetti.ApplyEnv(&cfg)
+	require.ErrorContains(t, err, "no PEM encoded certificate found")
+}
+
+func TestApplyIntBases(t *testing.T) {
+	type baseConfig struct {
+		Mask  uint8  `conf:"MASK"`
+		Perm  uint32 `conf:"PERM"`
+		Flags int    `conf:"FLAGS"`
+		Dec   int64  `conf:"DEC"`
+		Neg   int16  `conf:"NEG"`
+	}
+
+	content := `MASK=0xFF
+PERM=0o755
+FLAGS=0b101
+DEC=0755
+NEG=-0x10`
+
+	cfg := baseConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, uint8(255), cfg.Mask)
+	require.Equal(t, uint32(0o755), cfg.Perm)
+	require.Equal(t, 5, cfg.Flags)
+	require.Equal(t, int64(755), cfg.Dec)
+	require.Equal(t, int16(-16), cfg.Neg)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("MASK=0x100"))
+	require.Error(t, err)
+}
+
+// panicky panics when unmarshaled, standing in for a misbehaving third party type.
+type panicky struct{}
+
+func (*panicky) UnmarshalConfig(string) error {
+	panic("unmarshaling panicky")
+}
+
+func TestApplyRecoversPanics(t *testing.T) {
+	type panicConfig struct {
+		Name    string  `conf:"PANIC_NAME"`
+		Panicky panicky `conf:"PANIC_PANICKY"`
+		secret  string  `conf:"PANIC_SECRET"`
+	}
+
+	cfg := panicConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("PANIC_NAME=name\nPANIC_SECRET=secret"))
+	require.NoError(t, err)
+	require.Equal(t, "name", cfg.Name)
+	require.Empty(t, cfg.secret)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("PANIC_PANICKY=boom"))
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+	require.ErrorContains(t, err, "recovered from panic: unmarshaling panicky")
+
+	_, err = confetti.ApplyWithConsumed(
+		&cfg,
+		confetti.WithEnviron([]string{"PANIC_NAME=name"}),
+		confetti.WithFieldSetter("PANIC_NAME", func(any, string) error {
+			panic("setting name")
+		}),
+	)
+	require.ErrorContains(t, err, "recovered from panic: setting name")
+
+	require.Error(t, confetti.ApplyEnv(nil))
+	require.Error(t, confetti.ApplyEnv((*panicConfig)(nil)))
+}
+
+func TestApplySets(t *testing.T) {
+	type setConfig struct {
+		Allowed map[string]struct{} `conf:"ALLOWED"`
+		Ports   map[int]struct{}    `conf:"PORTS"`
+	}
+
+	cfg := setConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("ALLOWED=A,B,C\nPORTS=[80,443]"))
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Allowed, 3)
+	_, ok := cfg.Allowed["B"]
+	require.True(t, ok)
+	_, ok = cfg.Allowed["D"]
+	require.False(t, ok)
+	require.Equal(t, map[int]struct{}{80: {}, 443: {}}, cfg.Ports)
+
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+	require.Equal(t, "ALLOWED=A,B,C\nPORTS=443,80\n", string(out))
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("PORTS=http"))
+	require.Error(t, err)
+}
+
+func TestMergeSeparated(t *testing.T) {
+	type serviceConfig struct {
+		Service struct {
+			Name string   `conf:"NAME"`
+			DB   dbConfig `conf:"DB"`
+		} `conf:"SERVICE"`
+	}
+
+	snapshot := map[string]string{
+		"service/name":    "billing",
+		"service/db/host": "db.internal",
+		"service/db/port": "5432",
+	}
+
+	cfg := serviceConfig{}
+	err := confetti.MergeSeparated(&cfg, snapshot, "/")
+	require.NoError(t, err)
+
+	require.Equal(t, "billing", cfg.Service.Name)
+	require.Equal(t, "db.internal", cfg.Service.DB.Host)
+	require.Equal(t, 5432, cfg.Service.DB.Port)
+
+	err = confetti.MergeSeparated(&cfg, snapshot, "")
+	require.Error(t, err)
+}
+
+func TestApplyMapRemainder(t *testing.T) {
+	m := map[string]string{
+		"TEST_NAME":   "test",
+		"TEST_INT":    "42",
+		"OTHER_KEY":   "other",
+		"FORWARD_URL": "http://localhost",
+	}
+
+	cfg := testConfig{}
+	leftover, err := confetti.ApplyMapRemainder(&cfg, m)
+	require.NoError(t, err)
+
+	require.Equal(t, "test", cfg.String)
+	require.Equal(t, 42, cfg.Int)
+	require.Equal(t, map[string]string{
+		"OTHER_KEY":   "other",
+		"FORWARD_URL": "http://localhost",
+	}, leftover)
+	require.Len(t, m, 4)
+
+	_, err = confetti.ApplyMapRemainder(&cfg, map[string]string{"TEST_INT": "many"})
+	require.Error(t, err)
+}
+
+func TestApplyLocation(t *testing.T) {
+	type tzConfig struct {
+		TZ *time.Location `conf:"TZ"`
+	}
+
+	cfg := tzConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("TZ=America/New_York"))
+	require.NoError(t, err)
+	require.Equal(t, "America/New_York", cfg.TZ.String())
+
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+	require.Equal(t, "TZ=America/New_York\n", string(out))
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("TZ=Mars/Olympus_Mons"))
+	require.ErrorContains(t, err, `could not assign "Mars/Olympus_Mons" to location "TZ"`)
+}
+
+func TestApplyFilesBOM(t *testing.T) {
+	content := "TEST_NAME=héllo\nTEST_INT=42\n"
+
+	utf16LE := []byte{0xFF, 0xFE}
+	for _, unit := range utf16.Encode([]rune(content)) {
+		utf16LE = binary.LittleEndian.AppendUint16(utf16LE, unit)
+	}
+
+	utf16BE := []byte{0xFE, 0xFF}
+	for _, unit := range utf16.Encode([]rune(content)) {
+		utf16BE = binary.BigEndian.AppendUint16(utf16BE, unit)
+	}
+
+	files := map[string][]byte{
+		"utf8.env":    append([]byte{0xEF, 0xBB, 0xBF}, content...),
+		"utf16le.env": utf16LE,
+		"utf16be.env": utf16BE,
+	}
+
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		cfg := testConfig{}
+		err := confetti.ApplyFiles(&cfg, path)
+		require.NoError(t, err, name)
+		require.Equal(t, "héllo", cfg.String, name)
+		require.Equal(t, 42, cfg.Int, name)
+	}
+
+	path := filepath.Join(dir, "truncated.env")
+	require.NoError(t, os.WriteFile(path, []byte{0xFF, 0xFE, 'A'}, 0o600))
+	err := confetti.ApplyFiles(&testConfig{}, path)
+	require.ErrorContains(t, err, "truncated")
+}
+
+type hookConfig struct {
+	Host    string `conf:"HOOK_HOST"`
+	Port    int    `conf:"HOOK_PORT"`
+	Addr    string
+	calls   []string
+	failing bool
+}
+
+func (c *hookConfig) BeforeApply() {
+	c.calls = append(c.calls, "before")
+}
+
+func (c *hookConfig) AfterApply() error {
+	c.calls = append(c.calls, "after")
+	if c.failing {
+		return errors.New("invalid address")
+	}
+
+	c.Addr = fmt.Sprintf("%s:%d", c.Host, c.Port)
+	return nil
+}
+
+func TestApplyHooks(t *testing.T) {
+	cfg := hookConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("HOOK_HOST=localhost\nHOOK_PORT=8080"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"before", "after"}, cfg.calls)
+	require.Equal(t, "localhost:8080", cfg.Addr)
+
+	cfg = hookConfig{}
+	err = confetti.ApplyReader(&cfg, strings.NewReader("HOOK_PORT=http"))
+	require.Error(t, err)
+	require.Equal(t, []string{"before"}, cfg.calls)
+
+	cfg = hookConfig{failing: true}
+	_, err = confetti.LoadInto(&cfg)
+	require.ErrorContains(t, err, "invalid address")
+	require.Equal(t, []string{"before", "after"}, cfg.calls)
+}
+
+type Color int
+
+const (
+	Red Color = iota
+	Green
+)
+
+func (c Color) String() string {
+	return [...]string{"red", "green"}[c]
+}
+
+func TestRegisterEnum(t *testing.T) {
+	confetti.RegisterEnum(map[string]Color{"red": Red, "green": Green})
+
+	type enumConfig struct {
+		Color  Color   `conf:"COLOR"`
+		Colors []Color `conf:"COLORS"`
+	}
+
+	cfg := enumConfig{Color: Green}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("COLOR=red\nCOLORS=green,red"))
+	require.NoError(t, err)
+	require.Equal(t, Red, cfg.Color)
+	require.Equal(t, []Color{Green, Red}, cfg.Colors)
+
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+	require.Equal(t, "COLOR=red\nCOLORS=green,red\n", string(out))
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("COLOR=blue"))
+	require.ErrorContains(t, err, `unknown value, expected one of ["green" "red"]`)
+}
+
+func TestApplyValues(t *testing.T) {
+	type queryConfig struct {
+		Name  string   `conf:"name"`
+		Port  int      `conf:"port"`
+		Hosts []string `conf:"host"`
+		Ports []int    `conf:"ports"`
+	}
+
+	query, err := url.ParseQuery("name=first&name=second&port=8080&host=a,b&host=c&ports=80")
+	require.NoError(t, err)
+
+	cfg := queryConfig{}
+	err = confetti.ApplyValues(&cfg, query)
+	require.NoError(t, err)
+
+	require.Equal(t, "first", cfg.Name)
+	require.Equal(t, 8080, cfg.Port)
+	require.Equal(t, []string{"a,b", "c"}, cfg.Hosts)
+	require.Equal(t, []int{80}, cfg.Ports)
+
+	err = confetti.ApplyValues(&cfg, url.Values{"ports": {"80", "http"}})
+	require.ErrorContains(t, err, "index 1")
+}
+
+func TestApplyGlobBytes(t *testing.T) {
+	type bundleConfig struct {
+		Bundle []byte `conf:"BUNDLE,from=glob"`
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.pem"), []byte("second\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.pem"), []byte("first\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c.txt"), []byte("ignored\n"), 0o600))
+
+	cfg := bundleConfig{}
+	err := confetti.ApplyKeyVal(&cfg, "BUNDLE", filepath.Join(dir, "*.pem"))
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\n", string(cfg.Bundle))
+
+	err = confetti.ApplyKeyVal(&cfg, "BUNDLE", filepath.Join(dir, "*.key"))
+	require.ErrorContains(t, err, "no files match")
+}
+
+func TestApplyPlainIntBounds(t *testing.T) {
+	type boundsConfig struct {
+		Int  int  `conf:"BOUNDS_INT"`
+		Uint uint `conf:"BOUNDS_UINT"`
+	}
+
+	maxInt := strconv.FormatInt(math.MaxInt, 10)
+	minInt := strconv.FormatInt(math.MinInt, 10)
+	maxUint := strconv.FormatUint(math.MaxUint, 10)
+
+	cfg := boundsConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("BOUNDS_INT="+maxInt+"\nBOUNDS_UINT="+maxUint))
+	require.NoError(t, err)
+	require.Equal(t, math.MaxInt, cfg.Int)
+	require.Equal(t, uint(math.MaxUint), cfg.Uint)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("BOUNDS_INT="+minInt))
+	require.NoError(t, err)
+	require.Equal(t, math.MinInt, cfg.Int)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("BOUNDS_UINT=-1"))
+	require.Error(t, err)
+
+	if strconv.IntSize == 64 {
+		err = confetti.ApplyReader(&cfg, strings.NewReader("BOUNDS_INT=9223372036854775808"))
+		require.ErrorIs(t, err, strconv.ErrRange)
+
+		err = confetti.ApplyReader(&cfg, strings.NewReader("BOUNDS_UINT=18446744073709551616"))
+		require.ErrorIs(t, err, strconv.ErrRange)
+	} else {
+		err = confetti.ApplyReader(&cfg, strings.NewReader("BOUNDS_INT=2147483648"))
+		require.ErrorIs(t, err, strconv.ErrRange)
+
+		err = confetti.ApplyReader(&cfg, strings.NewReader("BOUNDS_UINT=4294967296"))
+		require.ErrorIs(t, err, strconv.ErrRange)
+	}
+}
+
+func TestApplyNetAddrs(t *testing.T) {
+	type addrConfig struct {
+		Listen *net.TCPAddr `conf:"LISTEN"`
+		Stats  *net.UDPAddr `conf:"STATS"`
+	}
+
+	cfg := addrConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("LISTEN=127.0.0.1:8080\nSTATS=[::1]:8125"))
+	require.NoError(t, err)
+
+	require.True(t, cfg.Listen.IP.Equal(net.IPv4(127, 0, 0, 1)))
+	require.Equal(t, 8080, cfg.Listen.Port)
+	require.True(t, cfg.Stats.IP.Equal(net.IPv6loopback))
+	require.Equal(t, 8125, cfg.Stats.Port)
+
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+	require.Equal(t, "LISTEN=127.0.0.1:8080\nSTATS=[::1]:8125\n", string(out))
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("LISTEN=127.0.0.1"))
+	require.ErrorContains(t, err, `could not assign "127.0.0.1" to TCP address "Listen"`)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("STATS=localhost:port"))
+	require.ErrorContains(t, err, "UDP address")
+}
+
+func TestApplySentinelErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.env")
+	require.NoError(t, os.WriteFile(path, []byte("TEST_INT=one"), 0o600))
+
+	cfg := testConfig{}
+	err := confetti.ApplyFiles(&cfg, filepath.Join(dir, "missing.env"))
+	require.ErrorIs(t, err, confetti.ErrFileNotFound)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.NotErrorIs(t, err, confetti.ErrCoercion)
+
+	err = confetti.ApplyFiles(&cfg, path)
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+	require.ErrorIs(t, err, strconv.ErrSyntax)
+	require.NotErrorIs(t, err, confetti.ErrFileNotFound)
+	require.ErrorContains(t, err, `could not assign "one" to int "Int"`)
+	require.NotContains(t, err.Error(), "coercion failed")
+
+	type chanConfig struct {
+		Chan chan int `conf:"CHAN"`
+	}
+
+	err = confetti.ApplyReader(&chanConfig{}, strings.NewReader("CHAN=1"))
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+	require.ErrorIs(t, err, confetti.ErrUnsupportedKind)
+}
+
+func TestApplyRaw(t *testing.T) {
+	type rawConfig struct {
+		Secret string `conf:"RAW_SECRET,raw"`
+		Quoted string `conf:"RAW_QUOTED,raw"`
+		Name   string `conf:"RAW_NAME"`
+	}
+
+	content := "RAW_SECRET=  p@ss # word  \nRAW_QUOTED=\"quoted\"\nRAW_NAME=  trimmed  \n"
+
+	cfg := rawConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, "  p@ss # word  ", cfg.Secret)
+	require.Equal(t, `"quoted"`, cfg.Quoted)
+	require.Equal(t, "trimmed", cfg.Name)
+
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+
+	var parsed rawConfig
+	require.NoError(t, confetti.ApplyReader(&parsed, bytes.NewReader(out)))
+	require.Equal(t, cfg, parsed)
+}
+
+type endpoint struct {
+	Host string
+	Port int
+}
+
+func (e *endpoint) UnmarshalConfig(value string) error {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return err
+	}
+
+	e.Host = host
+	e.Port, err = strconv.Atoi(port)
+	return err
+}
+
+func TestApplyUnmarshalers(t *testing.T) {
+	type unmarshalConfig struct {
+		Primary   endpoint            `conf:"PRIMARY"`
+		Endpoints []endpoint          `conf:"ENDPOINTS"`
+		Fallback  *endpoint           `conf:"FALLBACK"`
+		IPs       []net.IP            `conf:"IPS"`
+		Started   time.Time           `conf:"STARTED"`
+		Ports     map[string]endpoint `conf:"PORTS"`
+	}
+
+	content := `PRIMARY=a.local:80
+ENDPOINTS=b.local:81,c.local:82
+FALLBACK=d.local:83
+IPS=10.0.0.1,::1
+STARTED=2024-01-02T03:04:05Z
+PORTS=http:e.local:84`
+
+	cfg := unmarshalConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, endpoint{"a.local", 80}, cfg.Primary)
+	require.Equal(t, []endpoint{{"b.local", 81}, {"c.local", 82}}, cfg.Endpoints)
+	require.Equal(t, &endpoint{"d.local", 83}, cfg.Fallback)
+	require.Equal(t, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("::1")}, cfg.IPs)
+	require.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), cfg.Started)
+	require.Equal(t, map[string]endpoint{"http": {"e.local", 84}}, cfg.Ports)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("ENDPOINTS=b.local:81,c.local"))
+	require.ErrorContains(t, err, "index 1")
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader("FALLBACK=nowhere"))
+	require.Error(t, err)
+	require.Equal(t, &endpoint{"d.local", 83}, cfg.Fallback)
+}
+
+func TestApplyRawMessage(t *testing.T) {
+	type passthroughConfig struct {
+		Payload json.RawMessage `conf:"PAYLOAD,from=glob"`
+	}
+
+	cfg := passthroughConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(`PAYLOAD={"retries": [1, 2], "mode": "*.json"}`))
+	require.NoError(t, err)
+	require.Equal(t, json.RawMessage(`{"retries": [1, 2], "mode": "*.json"}`), cfg.Payload)
+
+	var decoded struct {
+		Retries []int
+	}
+	require.NoError(t, json.Unmarshal(cfg.Payload, &decoded))
+	require.Equal(t, []int{1, 2}, decoded.Retries)
+
+	err = confetti.ApplyReader(&cfg, strings.NewReader(`PAYLOAD={"retries":`))
+	require.ErrorContains(t, err, "invalid JSON")
+}
+
+func TestApplyRunes(t *testing.T) {
+	type charsetConfig struct {
+		Alphabet []rune  `conf:"ALPHABET,runes"`
+		IDs      []int32 `conf:"IDS"`
+	}
+
+	cfg := charsetConfig{}
+	require.NoError(t, confetti.ApplyKeyVal(&cfg, "ALPHABET", "aé日🙂"))
+	require.Equal(t, []rune{'a', 0xE9, 0x65E5, 0x1F642}, cfg.Alphabet)
+
+	// without the runes option int32 slices are still comma delimited lists
+	require.NoError(t, confetti.ApplyKeyVal(&cfg, "IDS", "1,2,3"))
+	require.Equal(t, []int32{1, 2, 3}, cfg.IDs)
+
+	m, err := confetti.ToMap(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, "aé日🙂", m["ALPHABET"])
+	require.Equal(t, "1,2,3", m["IDS"])
+}
+
+func TestApplyEnvPresence(t *testing.T) {
+	type presenceConfig struct {
+		Debug   bool `conf:"PRESENCE_DEBUG,presence"`
+		Verbose bool `conf:"PRESENCE_VERBOSE,presence"`
+	}
+
+	t.Setenv("PRESENCE_DEBUG", "")
+
+	cfg := presenceConfig{}
+	require.NoError(t, confetti.ApplyEnv(&cfg))
+	require.True(t, cfg.Debug)
+	require.False(t, cfg.Verbose)
+
+	t.Setenv("PRESENCE_VERBOSE", "0")
+
+	cfg = presenceConfig{}
+	require.NoError(t, confetti.ApplyEnv(&cfg, confetti.WithTrimSpace(true)))
+	require.True(t, cfg.Debug)
+	require.True(t, cfg.Verbose)
+
+	cfg = presenceConfig{}
+	require.NoError(t, confetti.ApplyReader(&cfg, strings.NewReader("PRESENCE_DEBUG=false")))
+	require.True(t, cfg.Debug)
+	require.False(t, cfg.Verbose)
+}
+
+func TestApplyColor(t *testing.T) {
+	type themeConfig struct {
+		Background color.RGBA `conf:"BG"`
+		Overlay    color.RGBA `conf:"OVERLAY"`
+	}
+
+	cfg := themeConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("BG=#ff8800\nOVERLAY=#ff8800cc"))
+	require.NoError(t, err)
+	require.Equal(t, color.RGBA{R: 0xff, G: 0x88, B: 0x00, A: 0xff}, cfg.Background)
+	require.Equal(t, color.RGBA{R: 0xff, G: 0x88, B: 0x00, A: 0xcc}, cfg.Overlay)
+
+	m, err := confetti.ToMap(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, "#ff8800", m["BG"])
+	require.Equal(t, "#ff8800cc", m["OVERLAY"])
+
+	err = confetti.ApplyKeyVal(&cfg, "BG", "#ff88zz")
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+
+	err = confetti.ApplyKeyVal(&cfg, "BG", "#f80")
+	require.ErrorContains(t, err, "expected 6 or 8 hex digits")
+}
+
+func TestApplyINI(t *testing.T) {
+	type iniConfig struct {
+		Name  string   `conf:"NAME"`
+		DB    dbConfig `conf:"DATABASE"`
+		Cache dbConfig `conf:"CACHE"`
+	}
+
+	path := filepath.Join(t.TempDir(), "legacy.ini")
+	require.NoError(t, os.WriteFile(path, []byte(`NAME=original
+
+[database]
+; the primary database
+host=db.local
+port=5432
+
+[ Cache ]
+Host=cache.local
+port=6379
+---
+NAME=legacy
+`), 0o600))
+
+	cfg := iniConfig{}
+	require.NoError(t, confetti.ApplyINI(&cfg, path))
+	require.Equal(t, iniConfig{
+		Name:  "legacy",
+		DB:    dbConfig{Host: "db.local", Port: 5432},
+		Cache: dbConfig{Host: "cache.local", Port: 6379},
+	}, cfg)
+}
+
+func TestApplyAtomic(t *testing.T) {
+	type reloadableConfig struct {
+		Limit   atomic.Int64 `conf:"LIMIT"`
+		Enabled atomic.Bool  `conf:"ENABLED"`
+	}
+
+	cfg := reloadableConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("LIMIT=0x40\nENABLED=yes"))
+	require.NoError(t, err)
+	require.Equal(t, int64(64), cfg.Limit.Load())
+	require.True(t, cfg.Enabled.Load())
+
+	m, err := confetti.ToMap(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, "64", m["LIMIT"])
+	require.Equal(t, "true", m["ENABLED"])
+
+	err = confetti.ApplyKeyVal(&cfg, "LIMIT", "lots")
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+	require.Equal(t, int64(64), cfg.Limit.Load())
+}
+
+func TestApplyNetip(t *testing.T) {
+	type netipConfig struct {
+		Addr    netip.Addr     `conf:"ADDR"`
+		Subnet  netip.Prefix   `conf:"SUBNET"`
+		Allowed []netip.Prefix `conf:"ALLOWED"`
+	}
+
+	cfg := netipConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(`ADDR=2001:db8::1
+SUBNET=10.0.0.0/8
+ALLOWED=192.168.0.0/16,fd00::/8`))
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParseAddr("2001:db8::1"), cfg.Addr)
+	require.True(t, cfg.Addr.Is6())
+	require.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), cfg.Subnet)
+	require.True(t, cfg.Subnet.Contains(netip.MustParseAddr("10.1.2.3")))
+	require.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("192.168.0.0/16"),
+		netip.MustParsePrefix("fd00::/8"),
+	}, cfg.Allowed)
+
+	m, err := confetti.ToMap(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8::1", m["ADDR"])
+	require.Equal(t, "10.0.0.0/8", m["SUBNET"])
+
+	err = confetti.ApplyKeyVal(&cfg, "ADDR", "2001:db8::zz")
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+	require.ErrorContains(t, err, `could not assign "2001:db8::zz" to "Addr"`)
+
+	err = confetti.ApplyKeyVal(&cfg, "SUBNET", "10.0.0.0/33")
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+	require.ErrorContains(t, err, "prefix length out of range")
+}
+
+func TestApplyRat(t *testing.T) {
+	type ratesConfig struct {
+		Share *big.Rat `conf:"SHARE"`
+		Fee   big.Rat  `conf:"FEE"`
+	}
+
+	cfg := ratesConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("SHARE=3/7\nFEE=0.5"))
+	require.NoError(t, err)
+	require.Equal(t, "3/7", cfg.Share.String())
+	require.Equal(t, "1/2", cfg.Fee.String())
+
+	m, err := confetti.ToMap(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, "3/7", m["SHARE"])
+	require.Equal(t, "1/2", m["FEE"])
+
+	err = confetti.ApplyKeyVal(&cfg, "SHARE", "3/seven")
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+	require.Equal(t, "3/7", cfg.Share.String())
+}
+
+func TestApplyStdin(t *testing.T) {
+	stdin, err := os.Open(writeFile(t, "stdin.env", "HOST=piped\nPORT=9000"))
+	require.NoError(t, err)
+	defer stdin.Close()
+
+	orig := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = orig })
+
+	cfg := dbConfig{}
+	require.NoError(t, confetti.ApplyStdin(&cfg))
+	require.Equal(t, dbConfig{Host: "piped", Port: 9000}, cfg)
+}
+
+func TestApplyJSONMap(t *testing.T) {
+	type jsonEndpoint struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+
+	type routesConfig struct {
+		Routes map[string]jsonEndpoint `conf:"ROUTES,json"`
+	}
+
+	cfg := routesConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader(
+		`ROUTES={"a": {"host": "x", "port": 80}, "b": {"host": "y"}}`,
+	))
+	require.NoError(t, err)
+	require.Equal(t, map[string]jsonEndpoint{
+		"a": {Host: "x", Port: 80},
+		"b": {Host: "y"},
+	}, cfg.Routes)
+
+	m, err := confetti.ToMap(&cfg)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"a": {"host": "x", "port": 80}, "b": {"host": "y", "port": 0}}`, m["ROUTES"])
+
+	err = confetti.ApplyKeyVal(&cfg, "ROUTES", `{"a": {"port": "eighty"}}`)
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+	require.Len(t, cfg.Routes, 2)
+}
+
+func TestApplyEnvMatch(t *testing.T) {
+	type flagsConfig struct {
+		Flags map[string]bool `conf:"FLAGS,match=^MATCH_FLAG_"`
+	}
+
+	t.Setenv("MATCH_FLAG_SEARCH", "true")
+	t.Setenv("MATCH_FLAG_BILLING", "false")
+	t.Setenv("OTHER_MATCH_FLAG_EXCLUDED", "true")
+	t.Setenv("FLAGS", "excluded:true")
+
+	cfg := flagsConfig{}
+	require.NoError(t, confetti.ApplyEnv(&cfg))
+	require.Equal(t, map[string]bool{"SEARCH": true, "BILLING": false}, cfg.Flags)
+
+	type invalidConfig struct {
+		Flags map[string]bool `conf:"FLAGS,match=^(FLAG_"`
+	}
+
+	err := confetti.ApplyEnv(&invalidConfig{})
+	require.ErrorContains(t, err, "invalid match pattern")
+}
+
+type packedVersion struct {
+	Major uint16
+	Minor uint16
+}
+
+func (v *packedVersion) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return fmt.Errorf("expected 4 bytes, got %d", len(data))
+	}
+
+	v.Major = binary.BigEndian.Uint16(data)
+	v.Minor = binary.BigEndian.Uint16(data[2:])
+	return nil
+}
+
+func TestApplyBinaryUnmarshaler(t *testing.T) {
+	type versionConfig struct {
+		Version packedVersion  `conf:"VERSION"`
+		Pinned  *packedVersion `conf:"PINNED"`
+	}
+
+	encoded := base64.StdEncoding.EncodeToString([]byte{0, 1, 0, 2})
+
+	cfg := versionConfig{}
+	err := confetti.ApplyReader(&cfg, strings.NewReader("VERSION="+encoded+"\nPINNED="+encoded))
+	require.NoError(t, err)
+	require.Equal(t, packedVersion{Major: 1, Minor: 2}, cfg.Version)
+	require.Equal(t, &packedVersion{Major: 1, Minor: 2}, cfg.Pinned)
+
+	err = confetti.ApplyKeyVal(&cfg, "VERSION", "not base64!")
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+
+	err = confetti.ApplyKeyVal(&cfg, "VERSION", base64.StdEncoding.EncodeToString([]byte{1}))
+	require.ErrorContains(t, err, "expected 4 bytes")
+}
@@ -0,0 +1,67 @@
+package confetti
+
+import (
+	"fmt"
+)
+
+// An Explanation describes how a config key resolves.
+type Explanation struct {
+	Key string
+	// Source is the path of the file that supplied the value, "env" for the
+	// environment, "fallback" for the [WithFallback] function, or "default" for the
+	// field's `default` tag option. It's empty if nothing supplied a value.
+	Source string
+	// Raw is the value as it appeared in the source.
+	Raw string
+	// Value is the field's value after coercion.
+	Value any
+}
+
+// Explain reports which source would supply the value for key if the target were
+// loaded with [LoadInto] using the given options, along with the coerced result. The
+// target's BeforeApply and AfterApply hooks run against a copy of it, so the target
+// itself is left untouched.
+func Explain(target any, key string, opts ...Option) (Explanation, error) {
+	l, _, err := newScratchLoader(target, newOptions(opts...))
+	if err != nil {
+		return Explanation{}, err
+	}
+
+	if err := l.hooked(l.load); err != nil {
+		return Explanation{}, err
+	}
+
+	for _, b := range l.bindings {
+		if b.key != l.mapKey(key) {
+			continue
+		}
+
+		return Explanation{
+			Key:    key,
+			Source: b.source,
+			Raw:    b.raw,
+			Value:  b.value.Interface(),
+		}, nil
+	}
+
+	return Explanation{}, fmt.Errorf("explaining %q: no field matches key %q", l.name, key)
+}
+
+// Unset returns the config keys of every field in target still holding its zero value.
+// Unlike a required check it never fails, making it useful for reporting config that
+// was expected but not provided after loading.
+func Unset(target any) ([]string, error) {
+	l, err := newLoader(target, newOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, b := range l.bindings {
+		if b.value.IsZero() {
+			keys = append(keys, b.key)
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,104 @@
+package confetti_test
+
+import (
+	"testing"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	path := writeFile(t, ".env", "LOAD_HOST=file\nLOAD_VERBOSE=yes")
+	t.Setenv("LOAD_HOST", "env")
+
+	cfg := loadConfig{}
+	explanation, err := confetti.Explain(&cfg, "LOAD_HOST", confetti.WithFiles(path))
+	require.NoError(t, err)
+	require.Equal(t, confetti.Explanation{
+		Key:    "LOAD_HOST",
+		Source: "env",
+		Raw:    "env",
+		Value:  "env",
+	}, explanation)
+
+	explanation, err = confetti.Explain(&cfg, "LOAD_VERBOSE", confetti.WithFiles(path))
+	require.NoError(t, err)
+	require.Equal(t, confetti.Explanation{
+		Key:    "LOAD_VERBOSE",
+		Source: path,
+		Raw:    "yes",
+		Value:  true,
+	}, explanation)
+
+	explanation, err = confetti.Explain(&cfg, "LOAD_PORT", confetti.WithFiles(path))
+	require.NoError(t, err)
+	require.Equal(t, "default", explanation.Source)
+	require.Equal(t, 8080, explanation.Value)
+
+	explanation, err = confetti.Explain(
+		&cfg,
+		"LOAD_HOST",
+		confetti.WithFiles(path),
+		confetti.WithFilesOverrideEnv(),
+	)
+	require.NoError(t, err)
+	require.Equal(t, path, explanation.Source)
+	require.Equal(t, "file", explanation.Value)
+
+	// explaining never applies anything to the target
+	require.Equal(t, loadConfig{}, cfg)
+
+	_, err = confetti.Explain(&cfg, "LOAD_MISSING")
+	require.Error(t, err)
+}
+
+func TestUnset(t *testing.T) {
+	t.Setenv("LOAD_HOST", "localhost")
+
+	cfg, _, err := confetti.Load[loadConfig]()
+	require.NoError(t, err)
+
+	unset, err := confetti.Unset(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, []string{"LOAD_VERBOSE"}, unset)
+
+	unset, err = confetti.Unset(&loadConfig{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"LOAD_HOST", "LOAD_PORT", "LOAD_TAGS", "LOAD_VERBOSE"}, unset)
+
+	_, err = confetti.Unset(cfg)
+	require.Error(t, err)
+}
+
+func TestExplainLeavesMapsUntouched(t *testing.T) {
+	type captureConfig struct {
+		Features map[string]string `conf:"EXPLAIN_FEATURE_,capture"`
+	}
+
+	cfg := captureConfig{Features: map[string]string{"Y": "orig"}}
+	explanation, err := confetti.Explain(
+		&cfg,
+		"EXPLAIN_FEATURE_",
+		confetti.WithEnviron([]string{"EXPLAIN_FEATURE_X=new"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"X": "new", "Y": "orig"}, explanation.Value)
+	require.Equal(t, map[string]string{"Y": "orig"}, cfg.Features)
+}
+
+func TestExplainRunsHooks(t *testing.T) {
+	cfg := hookConfig{}
+	explanation, err := confetti.Explain(
+		&cfg,
+		"Addr",
+		confetti.WithEnviron([]string{"HOOK_HOST=localhost", "HOOK_PORT=8080"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "localhost:8080", explanation.Value)
+	require.Empty(t, cfg.Addr)
+
+	_, err = confetti.Explain(&cfg, "HOOK_HOST", confetti.WithFallback(func(string) (string, bool) {
+		panic("fallback")
+	}))
+	require.ErrorContains(t, err, "recovered from panic: fallback")
+}
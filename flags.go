@@ -0,0 +1,46 @@
+package confetti
+
+import (
+	"flag"
+	"reflect"
+)
+
+// BindFlags registers a flag on fs for every config key of the given target. Each flag
+// defaults to the field's current value, so applying env or files before calling
+// BindFlags lets those values act as defaults while any parsed flags take precedence.
+// Parsed flags are written directly into the target.
+func BindFlags(fs *flag.FlagSet, target any) error {
+	l, err := newLoader(target, newOptions())
+	if err != nil {
+		return err
+	}
+
+	for _, b := range l.bindings {
+		fs.Var(&fieldFlag{binding: b}, b.key, "sets "+b.field.Name)
+	}
+
+	return nil
+}
+
+// fieldFlag is a [flag.Value] that coerces flag arguments directly into a struct field.
+type fieldFlag struct {
+	binding *binding
+}
+
+func (f *fieldFlag) String() string {
+	// the flag package calls String on a zero fieldFlag to detect zero defaults
+	if f.binding == nil {
+		return ""
+	}
+
+	return formatValue(f.binding, f.binding.value)
+}
+
+func (f *fieldFlag) Set(str string) error {
+	return coerceValue(f.binding, f.binding.value, str)
+}
+
+// IsBoolFlag allows bool fields to be passed as `-KEY` without a value.
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.binding != nil && f.binding.value.Kind() == reflect.Bool
+}
@@ -0,0 +1,47 @@
+package confetti_test
+
+import (
+	"flag"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindFlags(t *testing.T) {
+	type flagConfig struct {
+		Host    string        `conf:"FLAG_HOST"`
+		Port    int           `conf:"FLAG_PORT"`
+		Debug   bool          `conf:"FLAG_DEBUG"`
+		Timeout time.Duration `conf:"FLAG_TIMEOUT"`
+		Tags    []string      `conf:"FLAG_TAGS"`
+	}
+
+	t.Setenv("FLAG_HOST", "env-host")
+	t.Setenv("FLAG_PORT", "8080")
+	t.Setenv("FLAG_TIMEOUT", "5s")
+
+	cfg, err := confetti.FromEnv[flagConfig]()
+	require.NoError(t, err)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	require.NoError(t, confetti.BindFlags(fs, &cfg))
+
+	require.Equal(t, "env-host", fs.Lookup("FLAG_HOST").DefValue)
+	require.Equal(t, "5s", fs.Lookup("FLAG_TIMEOUT").DefValue)
+
+	err = fs.Parse([]string{"-FLAG_PORT=9090", "-FLAG_DEBUG", "-FLAG_TAGS", "a,b"})
+	require.NoError(t, err)
+
+	require.Equal(t, "env-host", cfg.Host)
+	require.Equal(t, 9090, cfg.Port)
+	require.True(t, cfg.Debug)
+	require.Equal(t, 5*time.Second, cfg.Timeout)
+	require.Equal(t, []string{"a", "b"}, cfg.Tags)
+
+	err = fs.Parse([]string{"-FLAG_PORT=nope"})
+	require.Error(t, err)
+}
@@ -0,0 +1,383 @@
+package confetti
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// WarningKind categorizes a [Warning].
+type WarningKind string
+
+const (
+	// WarningUnmatchedKey is raised for keys in a config file that don't match any field.
+	WarningUnmatchedKey WarningKind = "unmatched_key"
+	// WarningDefaultApplied is raised when a field falls back to its `default` tag option.
+	WarningDefaultApplied WarningKind = "default_applied"
+	// WarningDeprecatedKey is raised when a field is set through a deprecated key.
+	WarningDeprecatedKey WarningKind = "deprecated_key"
+)
+
+// A Warning describes a non-fatal issue encountered while loading config.
+type Warning struct {
+	Kind    WarningKind
+	Key     string
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Message
+}
+
+// EventKind categorizes an [Event].
+type EventKind string
+
+const (
+	// EventLookup is emitted when a source is checked for a key. For the environment this
+	// happens for every field, while for files it happens for every key in the file.
+	EventLookup EventKind = "lookup"
+	// EventApplied is emitted when a value has been coerced into a field.
+	EventApplied EventKind = "applied"
+)
+
+// An Event traces a step of applying config, as reported to [WithLogger].
+type Event struct {
+	Kind EventKind
+	Key  string
+	// Source names where the key was looked up or applied from, like [Explanation].
+	Source string
+	// Found reports whether a lookup found a value for a field.
+	Found bool
+	// Raw is the value as it appeared in the source.
+	Raw string
+	// Value is the field's value after coercion. It's only set for [EventApplied] and
+	// may be nil for unexported fields.
+	Value any
+}
+
+// A FieldError describes a value that couldn't be applied to a field while loading.
+type FieldError struct {
+	// File is the config file the value came from, or empty for the environment.
+	File string
+	// Line is the line of File the key appeared on, or zero for the environment.
+	Line int
+	Key  string
+	Err  error
+}
+
+func (e FieldError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("%s: %v", e.Key, e.Err)
+	}
+
+	return fmt.Sprintf("%s:%d: %s: %v", e.File, e.Line, e.Key, e.Err)
+}
+
+func (e FieldError) Unwrap() error {
+	return e.Err
+}
+
+// A MultiError is returned by [Load] and its relatives when values from files or the
+// environment can't be applied, listing every failure in the order they occurred.
+type MultiError struct {
+	Errors []FieldError
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// Load returns a type T hydrated by the given options. Files provided by [WithFiles] are
+// applied first followed by the environment, so environment variables take ultimate
+// precedence unless [WithFilesOverrideEnv] is given. Fields left unset are then offered
+// to the [WithFallback] function, if any. Any fields left unset and holding
+// their zero value afterwards are assigned the value of their `default` tag option, if
+// present:
+//
+//	type Config struct {
+//		Port    int    `conf:"PORT,default=8080"`
+//		DataDir string `conf:"DATA_DIR,default=${HOME}/data"`
+//	}
+//
+// Defaults may reference other keys or environment variables using $KEY or ${KEY}. With
+// [WithDefaultsFirst] defaults are applied before any source instead.
+//
+// Non-fatal issues, like file keys that don't match any field, are returned as warnings
+// alongside the config. Values that can't be coerced into their fields don't stop loading
+// early; once files and the environment have been applied they're all returned together
+// as a [*MultiError].
+func Load[T any](opts ...Option) (T, []Warning, error) {
+	var target T
+	warnings, err := LoadInto(&target, opts...)
+	return target, warnings, err
+}
+
+// Apply behaves like [Load] but returns a pointer to the hydrated T, discarding any
+// warnings.
+func Apply[T any](opts ...Option) (*T, error) {
+	target := new(T)
+	if _, err := LoadInto(target, opts...); err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// ApplyAll hydrates each of targets the same way as [LoadInto] using the same options,
+// discarding any warnings. Files given to [WithFiles] are read once up front, and so is
+// the environment, so every target sees the same snapshot of them. Loading stops at the
+// first target that fails.
+func ApplyAll(opts []Option, targets ...any) error {
+	o := newOptions(opts...)
+	opts = slices.Clip(opts)
+	if o.environ == nil {
+		opts = append(opts, WithEnviron(os.Environ()))
+	}
+
+	files, err := readSnapshot(o.filesFS(), o.files)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, withFS(files))
+
+	for _, target := range targets {
+		if _, err := LoadInto(target, opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// snapshotFS serves the contents of files as they were when read by readSnapshot. Files
+// that didn't exist then don't exist in the snapshot either.
+type snapshotFS map[string]*snapshotFile
+
+// readSnapshot reads every one of paths from fsys into a snapshotFS.
+func readSnapshot(fsys fs.FS, paths []string) (snapshotFS, error) {
+	snapshot := make(snapshotFS, len(paths))
+	for _, path := range paths {
+		data, err := fs.ReadFile(fsys, path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("parsing config file: %w", err)
+		}
+
+		info, err := fs.Stat(fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing config file: %w", err)
+		}
+
+		snapshot[path] = &snapshotFile{data: data, info: info}
+	}
+
+	return snapshot, nil
+}
+
+func (s snapshotFS) Open(name string) (fs.File, error) {
+	file, ok := s[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &snapshotReader{Reader: bytes.NewReader(file.data), info: file.info}, nil
+}
+
+// snapshotFile holds a file read into a snapshotFS.
+type snapshotFile struct {
+	data []byte
+	info fs.FileInfo
+}
+
+// snapshotReader is an open snapshotFile.
+type snapshotReader struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (r *snapshotReader) Stat() (fs.FileInfo, error) {
+	return r.info, nil
+}
+
+func (r *snapshotReader) Close() error {
+	return nil
+}
+
+// ApplyWithConsumed hydrates the given target the same way as [LoadInto], returning the
+// sorted keys read from files and the environment that matched a field. Keys are reported
+// as they appeared in their source, so a field set through a deprecated alias reports the
+// alias. Defaults and the [WithFallback] function don't consume keys.
+func ApplyWithConsumed(target any, opts ...Option) ([]string, error) {
+	l, err := newLoader(target, newOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.hooked(l.load)
+	return slices.Sorted(maps.Keys(l.consumed)), err
+}
+
+// LoadInto hydrates the given target the same way as [Load].
+func LoadInto(target any, opts ...Option) ([]Warning, error) {
+	o := newOptions(opts...)
+	if !o.atomic {
+		l, err := newLoader(target, o)
+		if err != nil {
+			return nil, err
+		}
+
+		err = l.hooked(l.load)
+		return l.warnings, err
+	}
+
+	// load into a copy of the target and only commit it once everything succeeds
+	l, scratch, err := newScratchLoader(target, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.hooked(l.load); err != nil {
+		return l.warnings, err
+	}
+
+	reflect.ValueOf(target).Elem().Set(scratch)
+	return l.warnings, nil
+}
+
+// newScratchLoader returns a loader over a shallow copy of target, along with the copy.
+// Fields are deep copied as they're written to, see loader.detach.
+func newScratchLoader(target any, o *options) (*loader, reflect.Value, error) {
+	_, targetVal, err := getTarget(target)
+	if err != nil {
+		return nil, reflect.Value{}, err
+	}
+
+	scratch := reflect.New(targetVal.Type())
+	scratch.Elem().Set(targetVal)
+	l, err := newLoader(scratch.Interface(), o)
+	if err != nil {
+		return nil, reflect.Value{}, err
+	}
+
+	l.scratch = true
+	return l, scratch.Elem(), nil
+}
+
+// load applies every configured source followed by defaults.
+func (l *loader) load() error {
+	l.collect = true
+	if l.opts.defaultsFirst {
+		if err := l.applyDefaults(); err != nil {
+			return err
+		}
+	}
+	applyFiles := func() error {
+		for _, path := range l.opts.files {
+			if err := l.applyFile(l.opts.filesFS(), path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	sources := []func() error{applyFiles, l.applyEnv}
+	if l.opts.filesOverrideEnv {
+		sources = []func() error{l.applyEnv, applyFiles}
+	}
+
+	for _, apply := range sources {
+		if err := apply(); err != nil {
+			return err
+		}
+	}
+
+	if len(l.failures) > 0 {
+		return fmt.Errorf("loading %q: %w", l.name, &MultiError{Errors: l.failures})
+	}
+
+	if err := l.applyFallback(); err != nil {
+		return err
+	}
+
+	if err := l.checkExclusive(); err != nil {
+		return err
+	}
+
+	if err := l.checkTogether(); err != nil {
+		return err
+	}
+
+	if l.opts.defaultsFirst {
+		l.warnDefaultsKept()
+		return nil
+	}
+
+	return l.applyDefaults()
+}
+
+// setKeys returns which of the given keys have been set by a source.
+func (l *loader) setKeys(keys []string) []string {
+	var set []string
+	for _, key := range keys {
+		key = l.mapKey(key)
+		for _, b := range l.bindings {
+			if b.set && b.key == key {
+				set = append(set, key)
+				break
+			}
+		}
+	}
+
+	return set
+}
+
+// checkExclusive enforces the groups given to [WithMutuallyExclusive].
+func (l *loader) checkExclusive() error {
+	for _, group := range l.opts.exclusive {
+		if set := l.setKeys(group); len(set) > 1 {
+			return fmt.Errorf("loading %q: keys %q are mutually exclusive", l.name, set)
+		}
+	}
+
+	return nil
+}
+
+// checkTogether enforces the groups given to [WithRequiredTogether].
+func (l *loader) checkTogether() error {
+	for _, group := range l.opts.together {
+		if set := l.setKeys(group); len(set) > 0 && len(set) < len(group) {
+			return fmt.Errorf(
+				"loading %q: keys %q must be set together, only %q are set",
+				l.name,
+				group,
+				set,
+			)
+		}
+	}
+
+	return nil
+}
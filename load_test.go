@@ -0,0 +1,790 @@
+package confetti_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+type loadConfig struct {
+	Host    string `conf:"LOAD_HOST"`
+	Port    int    `conf:"LOAD_PORT,default=8080"`
+	Tags    string `conf:"LOAD_TAGS,default=a,b,c"`
+	Verbose bool   `conf:"LOAD_VERBOSE"`
+}
+
+func TestLoad(t *testing.T) {
+	path := writeFile(t, ".env", `LOAD_HOST=file
+LOAD_VERBOSE=true
+LOAD_TAGS=x
+LOAD_UNKNOWN=1`)
+	t.Setenv("LOAD_HOST", "env")
+
+	cfg, warnings, err := confetti.Load[loadConfig](confetti.WithFiles(path))
+	require.NoError(t, err)
+
+	require.Equal(t, "env", cfg.Host)
+	require.Equal(t, 8080, cfg.Port)
+	require.Equal(t, "x", cfg.Tags)
+	require.True(t, cfg.Verbose)
+
+	require.Equal(t, []confetti.Warning{
+		{
+			Kind:    confetti.WarningUnmatchedKey,
+			Key:     "LOAD_UNKNOWN",
+			Message: `no field matches key "LOAD_UNKNOWN"`,
+		},
+		{
+			Kind:    confetti.WarningDefaultApplied,
+			Key:     "LOAD_PORT",
+			Message: `applied default "8080" for key "LOAD_PORT"`,
+		},
+	}, warnings)
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, warnings, err := confetti.Load[loadConfig]()
+	require.NoError(t, err)
+
+	require.Equal(t, 8080, cfg.Port)
+	require.Equal(t, "a,b,c", cfg.Tags)
+	require.Len(t, warnings, 2)
+	for _, warning := range warnings {
+		require.Equal(t, confetti.WarningDefaultApplied, warning.Kind)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	type badDefault struct {
+		Port int `conf:"LOAD_PORT,default=eighty"`
+	}
+
+	_, _, err := confetti.Load[badDefault]()
+	require.Error(t, err)
+
+	_, _, err = confetti.Load[loadConfig](confetti.WithFiles(filepath.Join(t.TempDir(), "missing")))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLoadDeprecatedKey(t *testing.T) {
+	type deprecatedConfig struct {
+		Name string `conf:"DEPRECATED_NEW,deprecated=DEPRECATED_OLD"`
+		Port int    `conf:"DEPRECATED_PORT,deprecated=DEPRECATED_OLD_PORT"`
+	}
+
+	path := writeFile(t, ".env", "DEPRECATED_OLD_PORT=9000")
+	t.Setenv("DEPRECATED_OLD", "old")
+
+	cfg, warnings, err := confetti.Load[deprecatedConfig](confetti.WithFiles(path))
+	require.NoError(t, err)
+
+	require.Equal(t, "old", cfg.Name)
+	require.Equal(t, 9000, cfg.Port)
+	require.Equal(t, []confetti.Warning{
+		{
+			Kind:    confetti.WarningDeprecatedKey,
+			Key:     "DEPRECATED_OLD_PORT",
+			Message: `key "DEPRECATED_OLD_PORT" is deprecated, use "DEPRECATED_PORT" instead`,
+		},
+		{
+			Kind:    confetti.WarningDeprecatedKey,
+			Key:     "DEPRECATED_OLD",
+			Message: `key "DEPRECATED_OLD" is deprecated, use "DEPRECATED_NEW" instead`,
+		},
+	}, warnings)
+
+	// the new key takes precedence and no deprecation is raised
+	t.Setenv("DEPRECATED_NEW", "new")
+	cfg, warnings, err = confetti.Load[deprecatedConfig]()
+	require.NoError(t, err)
+	require.Equal(t, "new", cfg.Name)
+	require.Empty(t, warnings)
+}
+
+func TestLoadFilesOverrideEnv(t *testing.T) {
+	path := writeFile(t, ".env", "LOAD_HOST=file")
+	t.Setenv("LOAD_HOST", "env")
+	t.Setenv("LOAD_PORT", "9000")
+
+	cfg, _, err := confetti.Load[loadConfig](confetti.WithFiles(path))
+	require.NoError(t, err)
+	require.Equal(t, "env", cfg.Host)
+
+	cfg, _, err = confetti.Load[loadConfig](
+		confetti.WithFiles(path),
+		confetti.WithFilesOverrideEnv(),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "file", cfg.Host)
+	require.Equal(t, 9000, cfg.Port)
+}
+
+func TestLoadInto(t *testing.T) {
+	path := writeFile(t, ".env", "LOAD_HOST=file")
+
+	cfg := loadConfig{Verbose: true}
+	warnings, err := confetti.LoadInto(&cfg, confetti.WithFiles(path))
+	require.NoError(t, err)
+	require.Len(t, warnings, 2)
+
+	require.Equal(t, "file", cfg.Host)
+	require.Equal(t, 8080, cfg.Port)
+	require.True(t, cfg.Verbose)
+
+	err = confetti.ApplyEnv(cfg)
+	require.Error(t, err)
+}
+
+func TestLoadAtomic(t *testing.T) {
+	good := writeFile(t, ".env", "LOAD_HOST=file\nLOAD_VERBOSE=true")
+	bad := writeFile(t, ".bad", "LOAD_TAGS=x\nLOAD_PORT=eighty")
+
+	original := loadConfig{Host: "original", Port: 1}
+	cfg := original
+	_, err := confetti.LoadInto(&cfg, confetti.WithFiles(good, bad), confetti.WithAtomic())
+	require.Error(t, err)
+	require.Equal(t, original, cfg)
+
+	// without the option the first file is left applied
+	_, err = confetti.LoadInto(&cfg, confetti.WithFiles(good, bad))
+	require.Error(t, err)
+	require.Equal(t, "file", cfg.Host)
+	require.True(t, cfg.Verbose)
+
+	cfg = original
+	_, err = confetti.LoadInto(&cfg, confetti.WithFiles(good), confetti.WithAtomic())
+	require.NoError(t, err)
+	require.Equal(t, "file", cfg.Host)
+	require.Equal(t, 1, cfg.Port)
+}
+
+func TestLoadAtomicMaps(t *testing.T) {
+	type captureConfig struct {
+		Features map[string]string `conf:"ATOMIC_FEATURE_,capture"`
+		Port     int               `conf:"ATOMIC_PORT"`
+	}
+
+	cfg := captureConfig{Features: map[string]string{"Y": "orig"}}
+	_, err := confetti.LoadInto(
+		&cfg,
+		confetti.WithEnviron([]string{"ATOMIC_FEATURE_X=new", "ATOMIC_PORT=eighty"}),
+		confetti.WithAtomic(),
+	)
+	require.Error(t, err)
+	require.Equal(t, map[string]string{"Y": "orig"}, cfg.Features)
+}
+
+func TestLoadAtomicKeepsUnboundPointers(t *testing.T) {
+	type cyclicConfig struct {
+		Host string         `conf:"ATOMIC_HOST"`
+		Loc  *time.Location `conf:"ATOMIC_LOC"`
+		Self *cyclicConfig
+	}
+
+	cfg := cyclicConfig{Loc: time.UTC}
+	cfg.Self = &cfg
+
+	_, err := confetti.LoadInto(
+		&cfg,
+		confetti.WithEnviron([]string{"ATOMIC_HOST=env"}),
+		confetti.WithAtomic(),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "env", cfg.Host)
+	require.True(t, cfg.Loc == time.UTC)
+	require.Same(t, &cfg, cfg.Self)
+}
+
+func TestLoadNameMapper(t *testing.T) {
+	type mapperConfig struct {
+		Host   string `conf:"MAPPER_HOST"`
+		Port   int    `conf:"MAPPER_PORT,deprecated=mapper_old_port"`
+		Region string
+	}
+
+	path := writeFile(t, ".env", "mapper_host=localhost\nmapper_old_port=9000")
+	t.Setenv("region", "us-east-1")
+
+	cfg, warnings, err := confetti.Load[mapperConfig](
+		confetti.WithFiles(path),
+		confetti.WithNameMapper(strings.ToUpper),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, "localhost", cfg.Host)
+	require.Equal(t, 9000, cfg.Port)
+	require.Equal(t, "us-east-1", cfg.Region)
+	require.Equal(t, []confetti.Warning{{
+		Kind:    confetti.WarningDeprecatedKey,
+		Key:     "mapper_old_port",
+		Message: `key "mapper_old_port" is deprecated, use "MAPPER_PORT" instead`,
+	}}, warnings)
+
+	// keys must match exactly without a mapper
+	cfg, warnings, err = confetti.Load[mapperConfig](confetti.WithFiles(path))
+	require.NoError(t, err)
+	require.Empty(t, cfg.Host)
+	require.Len(t, warnings, 2)
+}
+
+func TestLoadTagNames(t *testing.T) {
+	type mixedConfig struct {
+		Host    string `conf:"TAGS_HOST"`
+		Port    int    `env:"TAGS_PORT"`
+		Both    string `conf:"TAGS_CONF" env:"TAGS_ENV"`
+		Timeout int    `env:"TAGS_TIMEOUT,default=30"`
+	}
+
+	t.Setenv("TAGS_HOST", "localhost")
+	t.Setenv("TAGS_PORT", "8080")
+	t.Setenv("TAGS_CONF", "conf")
+	t.Setenv("TAGS_ENV", "env")
+
+	cfg, _, err := confetti.Load[mixedConfig](confetti.WithTagNames("conf", "env"))
+	require.NoError(t, err)
+	require.Equal(t, mixedConfig{
+		Host:    "localhost",
+		Port:    8080,
+		Both:    "conf",
+		Timeout: 30,
+	}, cfg)
+
+	cfg, _, err = confetti.Load[mixedConfig](confetti.WithTagNames("env", "conf"))
+	require.NoError(t, err)
+	require.Equal(t, "env", cfg.Both)
+
+	// only the conf tag is consulted by default
+	cfg, _, err = confetti.Load[mixedConfig]()
+	require.NoError(t, err)
+	require.Zero(t, cfg.Port)
+	require.Zero(t, cfg.Timeout)
+}
+
+func TestLoadTrimSpace(t *testing.T) {
+	type trimConfig struct {
+		EnvName  string `conf:"TRIM_ENV_NAME"`
+		FileName string `conf:"TRIM_FILE_NAME"`
+		Port     int    `conf:"TRIM_PORT"`
+	}
+
+	path := writeFile(t, ".env", "TRIM_FILE_NAME=  file  \n")
+	t.Setenv("TRIM_ENV_NAME", "  env  ")
+	t.Setenv("TRIM_PORT", " 8080 ")
+
+	// by default only file values are trimmed
+	cfg, _, err := confetti.Load[trimConfig](confetti.WithFiles(path))
+	require.Error(t, err)
+
+	t.Setenv("TRIM_PORT", "8080")
+	cfg, _, err = confetti.Load[trimConfig](confetti.WithFiles(path))
+	require.NoError(t, err)
+	require.Equal(t, "  env  ", cfg.EnvName)
+	require.Equal(t, "file", cfg.FileName)
+
+	t.Setenv("TRIM_PORT", " 8080 ")
+	cfg, _, err = confetti.Load[trimConfig](confetti.WithFiles(path), confetti.WithTrimSpace(true))
+	require.NoError(t, err)
+	require.Equal(t, "env", cfg.EnvName)
+	require.Equal(t, "file", cfg.FileName)
+	require.Equal(t, 8080, cfg.Port)
+
+	t.Setenv("TRIM_PORT", "8080")
+	cfg, _, err = confetti.Load[trimConfig](confetti.WithFiles(path), confetti.WithTrimSpace(false))
+	require.NoError(t, err)
+	require.Equal(t, "  env  ", cfg.EnvName)
+	require.Equal(t, "  file  ", cfg.FileName)
+}
+
+func TestLoadDefaultInterpolation(t *testing.T) {
+	type interpolatedConfig struct {
+		Host    string `conf:"INTERP_HOST"`
+		URL     string `conf:"INTERP_URL,default=http://${INTERP_HOST}:$INTERP_PORT/api"`
+		DataDir string `conf:"INTERP_DATA_DIR,default=${INTERP_HOME}/data"`
+		Missing string `conf:"INTERP_MISSING,default=${INTERP_UNSET}/data"`
+		Price   string `conf:"INTERP_PRICE,default=$$5"`
+	}
+
+	path := writeFile(t, ".env", "INTERP_HOST=localhost")
+	t.Setenv("INTERP_PORT", "8080")
+	t.Setenv("INTERP_HOME", "/home/test")
+
+	cfg, _, err := confetti.Load[interpolatedConfig](confetti.WithFiles(path))
+	require.NoError(t, err)
+
+	require.Equal(t, "http://localhost:8080/api", cfg.URL)
+	require.Equal(t, "/home/test/data", cfg.DataDir)
+	require.Equal(t, "/data", cfg.Missing)
+	require.Equal(t, "$5", cfg.Price)
+}
+
+func TestLoadFallback(t *testing.T) {
+	t.Setenv("LOAD_HOST", "env")
+
+	var consulted []string
+	fallback := func(key string) (string, bool) {
+		consulted = append(consulted, key)
+		switch key {
+		case "LOAD_HOST":
+			return "fallback", true
+		case "LOAD_TAGS":
+			return "remote", true
+		default:
+			return "", false
+		}
+	}
+
+	cfg, _, err := confetti.Load[loadConfig](confetti.WithFallback(fallback))
+	require.NoError(t, err)
+
+	require.Equal(t, "env", cfg.Host)
+	require.Equal(t, "remote", cfg.Tags)
+	require.Equal(t, 8080, cfg.Port)
+	require.Equal(t, []string{"LOAD_PORT", "LOAD_TAGS", "LOAD_VERBOSE"}, consulted)
+
+	explanation, err := confetti.Explain(&loadConfig{}, "LOAD_TAGS", confetti.WithFallback(fallback))
+	require.NoError(t, err)
+	require.Equal(t, "fallback", explanation.Source)
+
+	_, _, err = confetti.Load[loadConfig](confetti.WithFallback(func(string) (string, bool) {
+		return "invalid", true
+	}))
+	require.Error(t, err)
+}
+
+func TestLoadRawValues(t *testing.T) {
+	type rawConfig struct {
+		Host     string            `conf:"RAW_HOST"`
+		Timeout  time.Duration     `conf:"RAW_TIMEOUT"`
+		Enabled  bool              `conf:"RAW_ENABLED"`
+		Port     int               `conf:"RAW_PORT,default=8080"`
+		Features map[string]string `conf:"RAW_FEATURE_,capture"`
+		Unset    string            `conf:"RAW_UNSET"`
+	}
+
+	path := writeFile(t, ".env", "RAW_HOST=file\nRAW_TIMEOUT=1m30s\nRAW_FEATURE_SEARCH=on")
+	t.Setenv("RAW_HOST", "env")
+	t.Setenv("RAW_ENABLED", "yes")
+
+	raw := make(map[string]string)
+	cfg, _, err := confetti.Load[rawConfig](confetti.WithFiles(path), confetti.WithRawValues(raw))
+	require.NoError(t, err)
+
+	require.Equal(t, 90*time.Second, cfg.Timeout)
+	require.Equal(t, map[string]string{
+		"RAW_HOST":           "env",
+		"RAW_TIMEOUT":        "1m30s",
+		"RAW_ENABLED":        "yes",
+		"RAW_PORT":           "8080",
+		"RAW_FEATURE_SEARCH": "on",
+	}, raw)
+}
+
+func TestLoadMutuallyExclusive(t *testing.T) {
+	type tlsConfig struct {
+		CertFile   string `conf:"EXCL_CERT_FILE"`
+		CertInline string `conf:"EXCL_CERT_INLINE,default=inline"`
+	}
+
+	exclusive := confetti.WithMutuallyExclusive("EXCL_CERT_FILE", "EXCL_CERT_INLINE")
+
+	t.Setenv("EXCL_CERT_FILE", "cert.pem")
+	cfg, _, err := confetti.Load[tlsConfig](exclusive)
+	require.NoError(t, err)
+	require.Equal(t, "cert.pem", cfg.CertFile)
+
+	t.Setenv("EXCL_CERT_INLINE", "-----BEGIN CERTIFICATE-----")
+	_, _, err = confetti.Load[tlsConfig](exclusive)
+	require.ErrorContains(t, err, "mutually exclusive")
+}
+
+func TestLoadRequiredTogether(t *testing.T) {
+	type credsConfig struct {
+		User string `conf:"TOGETHER_USER"`
+		Pass string `conf:"TOGETHER_PASS"`
+		Host string `conf:"TOGETHER_HOST,default=localhost"`
+	}
+
+	together := confetti.WithRequiredTogether("TOGETHER_USER", "TOGETHER_PASS", "TOGETHER_HOST")
+
+	_, _, err := confetti.Load[credsConfig](together)
+	require.NoError(t, err)
+
+	t.Setenv("TOGETHER_USER", "admin")
+	t.Setenv("TOGETHER_PASS", "hunter2")
+	_, _, err = confetti.Load[credsConfig](together)
+	require.ErrorContains(t, err, "must be set together")
+
+	t.Setenv("TOGETHER_HOST", "db")
+	cfg, _, err := confetti.Load[credsConfig](together)
+	require.NoError(t, err)
+	require.Equal(t, "db", cfg.Host)
+}
+
+func TestLoadLogger(t *testing.T) {
+	type logConfig struct {
+		Host string `conf:"LOG_HOST"`
+		Port int    `conf:"LOG_PORT,default=8080"`
+	}
+
+	path := writeFile(t, ".env", "LOG_HOST=file\nLOG_OTHER=x")
+	t.Setenv("LOG_HOST", "env")
+
+	var events []confetti.Event
+	_, _, err := confetti.Load[logConfig](
+		confetti.WithFiles(path),
+		confetti.WithLogger(func(event confetti.Event) {
+			events = append(events, event)
+		}),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, []confetti.Event{
+		{Kind: confetti.EventLookup, Key: "LOG_HOST", Source: path, Found: true, Raw: "file"},
+		{Kind: confetti.EventApplied, Key: "LOG_HOST", Source: path, Raw: "file", Value: "file"},
+		{Kind: confetti.EventLookup, Key: "LOG_OTHER", Source: path, Raw: "x"},
+		{Kind: confetti.EventLookup, Key: "LOG_HOST", Source: "env", Found: true, Raw: "env"},
+		{Kind: confetti.EventApplied, Key: "LOG_HOST", Source: "env", Raw: "env", Value: "env"},
+		{Kind: confetti.EventLookup, Key: "LOG_PORT", Source: "env"},
+		{Kind: confetti.EventApplied, Key: "LOG_PORT", Source: "default", Raw: "8080", Value: 8080},
+	}, events)
+}
+
+func TestLoadEnviron(t *testing.T) {
+	t.Setenv("LOAD_HOST", "live")
+	t.Setenv("LOAD_VERBOSE", "true")
+
+	cfg, _, err := confetti.Load[loadConfig](confetti.WithEnviron([]string{
+		"LOAD_HOST=crafted",
+		"LOAD_PORT=9090",
+		"LOAD_TAGS=x=y",
+	}))
+	require.NoError(t, err)
+
+	require.Equal(t, "crafted", cfg.Host)
+	require.Equal(t, 9090, cfg.Port)
+	require.Equal(t, "x=y", cfg.Tags)
+	require.False(t, cfg.Verbose)
+}
+
+func TestApply(t *testing.T) {
+	path := writeFile(t, ".env", "LOAD_HOST=file\nLOAD_VERBOSE=true")
+
+	cfg, err := confetti.Apply[loadConfig](confetti.WithFiles(path))
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	require.Equal(t, &loadConfig{Host: "file", Port: 8080, Tags: "a,b,c", Verbose: true}, cfg)
+
+	cfg, err = confetti.Apply[loadConfig](confetti.WithFiles(path + ".missing"))
+	require.Error(t, err)
+	require.Nil(t, cfg)
+}
+
+func TestLoadEnvCaseFolding(t *testing.T) {
+	type foldConfig struct {
+		Path string `conf:"FOLD_PATH"`
+		Home string `conf:"fold_home"`
+	}
+
+	environ := confetti.WithEnviron([]string{"Fold_Path=/bin", "FOLD_HOME=/home"})
+
+	cfg, _, err := confetti.Load[foldConfig](environ, confetti.WithEnvCaseFolding(true))
+	require.NoError(t, err)
+	require.Equal(t, foldConfig{Path: "/bin", Home: "/home"}, cfg)
+
+	cfg, _, err = confetti.Load[foldConfig](environ, confetti.WithEnvCaseFolding(false))
+	require.NoError(t, err)
+	require.Empty(t, cfg)
+
+	cfg, _, err = confetti.Load[foldConfig](environ)
+	require.NoError(t, err)
+	if runtime.GOOS == "windows" {
+		require.Equal(t, foldConfig{Path: "/bin", Home: "/home"}, cfg)
+	} else {
+		require.Empty(t, cfg)
+	}
+}
+
+func TestLoadStripPrefix(t *testing.T) {
+	path := writeFile(t, ".env", "APP_LOAD_HOST=prefixed\nAPP_LOAD_PORT=9090\nLOAD_VERBOSE=true")
+
+	cfg, warnings, err := confetti.Load[loadConfig](
+		confetti.WithFiles(path),
+		confetti.WithStripPrefix("APP_"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "prefixed", cfg.Host)
+	require.Equal(t, 9090, cfg.Port)
+	require.True(t, cfg.Verbose)
+	for _, warning := range warnings {
+		require.NotEqual(t, confetti.WarningUnmatchedKey, warning.Kind)
+	}
+}
+
+func TestLoadMultiError(t *testing.T) {
+	first := writeFile(t, "first.env", "LOAD_HOST=first\nLOAD_PORT=eighty\n")
+	second := writeFile(t, "second.env", `# overrides
+LOAD_TAGS<<EOF
+x
+y
+EOF
+LOAD_VERBOSE=maybe
+LOAD_PORT=8081`)
+
+	_, _, err := confetti.Load[loadConfig](
+		confetti.WithFiles(first, second),
+		confetti.WithEnviron([]string{"LOAD_VERBOSE=sometimes"}),
+	)
+
+	var multi *confetti.MultiError
+	require.ErrorAs(t, err, &multi)
+	require.Len(t, multi.Errors, 3)
+
+	require.Equal(t, first, multi.Errors[0].File)
+	require.Equal(t, 2, multi.Errors[0].Line)
+	require.Equal(t, "LOAD_PORT", multi.Errors[0].Key)
+	require.ErrorIs(t, multi.Errors[0].Err, confetti.ErrCoercion)
+
+	require.Equal(t, second, multi.Errors[1].File)
+	require.Equal(t, 6, multi.Errors[1].Line)
+	require.Equal(t, "LOAD_VERBOSE", multi.Errors[1].Key)
+
+	require.Empty(t, multi.Errors[2].File)
+	require.Zero(t, multi.Errors[2].Line)
+	require.Equal(t, "LOAD_VERBOSE", multi.Errors[2].Key)
+
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+	require.ErrorContains(t, err, first+":2: LOAD_PORT: ")
+}
+
+func TestLoadDefaultsFirst(t *testing.T) {
+	path := writeFile(t, ".env", "LOAD_TAGS=x")
+	environ := confetti.WithEnviron([]string{"LOAD_PORT=9090"})
+
+	for _, first := range []bool{false, true} {
+		opts := []confetti.Option{confetti.WithFiles(path), environ}
+		if first {
+			opts = append(opts, confetti.WithDefaultsFirst())
+		}
+
+		cfg, warnings, err := confetti.Load[loadConfig](opts...)
+		require.NoError(t, err)
+		require.Equal(t, loadConfig{Port: 9090, Tags: "x"}, cfg)
+		require.Empty(t, warnings)
+	}
+
+	cfg, warnings, err := confetti.Load[loadConfig](environ, confetti.WithDefaultsFirst())
+	require.NoError(t, err)
+	require.Equal(t, loadConfig{Port: 9090, Tags: "a,b,c"}, cfg)
+	require.Equal(t, []confetti.Warning{{
+		Kind:    confetti.WarningDefaultApplied,
+		Key:     "LOAD_TAGS",
+		Message: `applied default "a,b,c" for key "LOAD_TAGS"`,
+	}}, warnings)
+}
+
+func TestApplyWithConsumed(t *testing.T) {
+	path := writeFile(t, ".env", "LOAD_HOST=file\nLOAD_UNKNOWN=1")
+
+	cfg := loadConfig{}
+	consumed, err := confetti.ApplyWithConsumed(
+		&cfg,
+		confetti.WithFiles(path),
+		confetti.WithEnviron([]string{"LOAD_VERBOSE=true", "LOAD_OTHER=1"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"LOAD_HOST", "LOAD_VERBOSE"}, consumed)
+	require.Equal(t, loadConfig{Host: "file", Port: 8080, Tags: "a,b,c", Verbose: true}, cfg)
+}
+
+func TestLoadMergeAppend(t *testing.T) {
+	type tagsConfig struct {
+		Tags     []string `conf:"MERGE_TAGS"`
+		Appended []string `conf:"MERGE_APPENDED,merge=append"`
+	}
+
+	first := writeFile(t, "first.env", "MERGE_TAGS=a,b\nMERGE_APPENDED=a,b")
+	second := writeFile(t, "second.env", "MERGE_TAGS=c\nMERGE_APPENDED=c")
+
+	cfg, _, err := confetti.Load[tagsConfig](confetti.WithFiles(first, second))
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, cfg.Tags)
+	require.Equal(t, []string{"a", "b", "c"}, cfg.Appended)
+
+	cfg, _, err = confetti.Load[tagsConfig](
+		confetti.WithFiles(first),
+		confetti.WithEnviron([]string{"MERGE_APPENDED=d"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "d"}, cfg.Appended)
+}
+
+func TestLoadRequireTag(t *testing.T) {
+	type strictConfig struct {
+		Host      string `conf:"STRICT_HOST"`
+		StrictKey string
+		Untagged  struct {
+			Port int `conf:"PORT"`
+		}
+	}
+
+	environ := confetti.WithEnviron([]string{
+		"STRICT_HOST=tagged",
+		"StrictKey=untagged",
+		"Untagged_PORT=8080",
+	})
+
+	cfg, _, err := confetti.Load[strictConfig](environ)
+	require.NoError(t, err)
+	require.Equal(t, "tagged", cfg.Host)
+	require.Equal(t, "untagged", cfg.StrictKey)
+	require.Equal(t, 8080, cfg.Untagged.Port)
+
+	cfg, _, err = confetti.Load[strictConfig](environ, confetti.WithRequireTag())
+	require.NoError(t, err)
+	require.Equal(t, "tagged", cfg.Host)
+	require.Empty(t, cfg.StrictKey)
+	require.Zero(t, cfg.Untagged.Port)
+}
+
+func TestLoadFieldSetter(t *testing.T) {
+	type listenConfig struct {
+		Port int    `conf:"SETTER_PORT"`
+		Addr string `conf:"SETTER_ADDR"`
+	}
+
+	errReserved := errors.New("reserved port")
+	setter := confetti.WithFieldSetter("SETTER_PORT", func(target any, raw string) error {
+		if raw == "0" {
+			return errReserved
+		}
+
+		cfg := target.(*listenConfig)
+		cfg.Addr = ":" + raw
+		cfg.Port = len(raw)
+		return nil
+	})
+
+	cfg, _, err := confetti.Load[listenConfig](
+		confetti.WithEnviron([]string{"SETTER_PORT=8080"}),
+		setter,
+	)
+	require.NoError(t, err)
+	require.Equal(t, listenConfig{Port: 4, Addr: ":8080"}, cfg)
+
+	_, _, err = confetti.Load[listenConfig](confetti.WithEnviron([]string{"SETTER_PORT=0"}), setter)
+	require.ErrorIs(t, err, errReserved)
+}
+
+func TestApplyAll(t *testing.T) {
+	type serverConfig struct {
+		Host string `conf:"ALL_HOST"`
+		Port int    `conf:"ALL_PORT,default=8080"`
+	}
+
+	type workerConfig struct {
+		Queue   string `conf:"ALL_QUEUE"`
+		Workers int    `conf:"ALL_WORKERS"`
+	}
+
+	t.Setenv("ALL_HOST", "localhost")
+	t.Setenv("ALL_QUEUE", "jobs")
+	t.Setenv("ALL_WORKERS", "4")
+
+	server := serverConfig{}
+	worker := workerConfig{}
+	require.NoError(t, confetti.ApplyAll(nil, &server, &worker))
+	require.Equal(t, serverConfig{Host: "localhost", Port: 8080}, server)
+	require.Equal(t, workerConfig{Queue: "jobs", Workers: 4}, worker)
+
+	environ := []confetti.Option{confetti.WithEnviron([]string{"ALL_WORKERS=many"})}
+	err := confetti.ApplyAll(environ, &server, &worker)
+	require.ErrorIs(t, err, confetti.ErrCoercion)
+
+	// files are read once, so rewriting them partway through doesn't affect later targets
+	path := writeFile(t, "all.env", "ALL_HOST=original")
+	rewriting := rewritingConfig{path: path}
+	server = serverConfig{}
+	files := []confetti.Option{confetti.WithFiles(path), confetti.WithEnviron([]string{})}
+	require.NoError(t, confetti.ApplyAll(files, &rewriting, &server))
+	require.Equal(t, "original", rewriting.Host)
+	require.Equal(t, "original", server.Host)
+
+	missing := []confetti.Option{confetti.WithFiles(path + ".missing")}
+	err = confetti.ApplyAll(missing, &server)
+	require.ErrorIs(t, err, confetti.ErrFileNotFound)
+}
+
+// rewritingConfig rewrites the file at path once it's been applied.
+type rewritingConfig struct {
+	Host string `conf:"ALL_HOST"`
+	path string
+}
+
+func (c *rewritingConfig) AfterApply() error {
+	return os.WriteFile(c.path, []byte("ALL_HOST=rewritten"), 0o600)
+}
+
+func TestLoadCommentPrefix(t *testing.T) {
+	path := writeFile(t, ".env", `; a comment
+LOAD_HOST=#primary ; the host
+  ;LOAD_PORT=9090
+LOAD_TAGS=a # b`)
+
+	cfg, _, err := confetti.Load[loadConfig](
+		confetti.WithFiles(path),
+		confetti.WithCommentPrefix(";"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "#primary", cfg.Host)
+	require.Equal(t, 8080, cfg.Port)
+	require.Equal(t, "a # b", cfg.Tags)
+
+	path = writeFile(t, ".env", "// a comment\nLOAD_HOST=http://host // the host")
+	cfg, _, err = confetti.Load[loadConfig](
+		confetti.WithFiles(path),
+		confetti.WithCommentPrefix("//"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "http://host", cfg.Host)
+}
+
+func TestLoadResolveTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	slow := confetti.WithFallback(func(key string) (string, bool) {
+		if key == "LOAD_TAGS" {
+			<-release
+		}
+
+		return "resolved", key == "LOAD_HOST"
+	})
+
+	_, _, err := confetti.Load[loadConfig](slow, confetti.WithResolveTimeout(10*time.Millisecond))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, `resolving "LOAD_TAGS"`)
+
+	fast := confetti.WithFallback(func(key string) (string, bool) {
+		return "resolved", key == "LOAD_HOST"
+	})
+
+	cfg, _, err := confetti.Load[loadConfig](fast, confetti.WithResolveTimeout(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, "resolved", cfg.Host)
+}
@@ -0,0 +1,1080 @@
+package confetti
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// whitespace is trimmed from keys, and from values unless disabled by [WithTrimSpace].
+const whitespace = " \t\n"
+
+// ErrFileNotFound is matched by errors raised when a config file doesn't exist, so
+// callers can tell missing files apart from bad values using [errors.Is].
+var ErrFileNotFound = errors.New("config file not found")
+
+// sectionSeparator splits a single config file into multiple sections that are applied
+// in order.
+const sectionSeparator = "---"
+
+// Names of the non-file sources config can be applied from.
+const (
+	sourceEnv      = "env"
+	sourceDefault  = "default"
+	sourceReader   = "reader"
+	sourceFallback = "fallback"
+	sourceMap      = "map"
+	sourceValues   = "values"
+)
+
+// binding ties a struct field to the config key it's matched by.
+type binding struct {
+	key   string
+	opts  tagOptions
+	field reflect.StructField
+	value reflect.Value
+
+	// pattern is the compiled `match` option, if any
+	pattern *regexp.Regexp
+
+	// set tracks whether a source has set the field along with where the value came
+	// from and what it looked like before being coerced.
+	set    bool
+	source string
+	raw    string
+
+	// detached tracks whether the field has been deep copied, see loader.detach
+	detached bool
+}
+
+// captures reports whether the binding collects many keys into its map field through
+// the `capture` or `match` options rather than matching a single key.
+func (b *binding) captures() bool {
+	return b.opts.has("capture") || b.pattern != nil
+}
+
+// match reports whether key configures the binding and whether it did so through the
+// binding's deprecated alias.
+func (b *binding) match(key string) (bool, bool) {
+	if b.captures() {
+		return false, false
+	}
+
+	if key == b.key {
+		return true, false
+	}
+
+	old, ok := b.opts["deprecated"]
+	return ok && key == old, true
+}
+
+// capture reports whether key falls under the binding's prefix when it has the
+// `capture` option, or matches its pattern when it has the `match` option, returning
+// the remainder of the key.
+func (b *binding) capture(key string) (string, bool) {
+	if b.pattern != nil {
+		loc := b.pattern.FindStringIndex(key)
+		if loc == nil {
+			return "", false
+		}
+
+		suffix := key[:loc[0]] + key[loc[1]:]
+		return suffix, suffix != ""
+	}
+
+	if !b.opts.has("capture") {
+		return "", false
+	}
+
+	suffix, ok := strings.CutPrefix(key, b.key)
+	return suffix, ok && suffix != ""
+}
+
+// loader applies config sources to a target struct, keeping track of which fields
+// have been set and any warnings raised along the way.
+type loader struct {
+	target   any
+	opts     *options
+	name     string
+	bindings []*binding
+	warnings []Warning
+
+	// source names the source currently being applied
+	source string
+
+	// namespace restricts file keys to those it prefixes, stripping it before matching
+	namespace string
+
+	// sections makes INI style [section] headers prefix the keys beneath them
+	sections bool
+
+	// lint makes parseReader record malformed lines as failures rather than skip them
+	lint bool
+
+	// line is the line of the key currently being parsed, or zero outside of parsing
+	line int
+
+	// collect makes failures to set a field get recorded rather than returned, so every
+	// problem can be reported at once by a [MultiError]
+	collect  bool
+	failures []FieldError
+
+	// consumed holds every key read from a source that matched a field
+	consumed map[string]bool
+
+	// scratch marks the target as a shallow copy whose fields must be detached before
+	// being written to
+	scratch bool
+}
+
+func newLoader(target any, opts *options) (*loader, error) {
+	targetType, targetVal, err := getTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &loader{
+		target:   target,
+		opts:     opts,
+		name:     targetType.Name(),
+		source:   sourceReader,
+		consumed: make(map[string]bool),
+	}
+	l.bind(targetVal, "")
+
+	for _, b := range l.bindings {
+		pattern, ok := b.opts["match"]
+		if !ok {
+			continue
+		}
+
+		if b.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("binding %q: invalid match pattern: %w", b.field.Name, err)
+		}
+	}
+
+	return l, nil
+}
+
+// beforeApplier is implemented by targets that need to be prepared before config is
+// applied to them, e.g. to allocate maps.
+type beforeApplier interface {
+	BeforeApply()
+}
+
+// afterApplier is implemented by targets that compute derived fields or validate
+// themselves once config has been applied.
+type afterApplier interface {
+	AfterApply() error
+}
+
+// hooked runs apply between the target's BeforeApply and AfterApply hooks, if it has
+// them. AfterApply is only run if apply succeeds. Panics raised along the way, e.g. by a
+// hook or a [WithFieldSetter] callback, are recovered and returned as errors.
+func (l *loader) hooked(apply func() error) error {
+	return l.recovered(func() error {
+		if before, ok := l.target.(beforeApplier); ok {
+			before.BeforeApply()
+		}
+
+		if err := apply(); err != nil {
+			return err
+		}
+
+		if after, ok := l.target.(afterApplier); ok {
+			if err := after.AfterApply(); err != nil {
+				return fmt.Errorf("running AfterApply for %q: %w", l.name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// recovered runs apply, returning any panic it raises as an error.
+func (l *loader) recovered(apply func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("applying config to %q: recovered from panic: %v", l.name, r)
+		}
+	}()
+
+	return apply()
+}
+
+// bind creates bindings for every field of the given struct value. Nested structs are
+// bound recursively with their keys prefixed by the parent field's key, e.g. the Host
+// field of a DB field is keyed DB_HOST. Embedded structs and fields with the `inline`
+// option have their fields promoted without a prefix. Fields without a key in their tag
+// are skipped when [WithRequireTag] is given.
+func (l *loader) bind(structVal reflect.Value, prefix string) {
+	structType := structVal.Type()
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		if !field.IsExported() && !(field.Anonymous && isNested(field)) {
+			// unexported fields can't be set, so they're never configured, though the
+			// exported fields promoted from an unexported embedded struct can be
+			continue
+		}
+
+		key, opts, tagged := parseTag(field, l.opts.tagNames...)
+		if isNested(field) {
+			if field.Anonymous || opts.has("inline") {
+				l.bind(structVal.Field(i), prefix)
+			} else if tagged || !l.opts.requireTag {
+				l.bind(structVal.Field(i), prefix+key+"_")
+			}
+			continue
+		}
+
+		if !tagged && l.opts.requireTag {
+			continue
+		}
+
+		if old, ok := opts["deprecated"]; ok {
+			opts["deprecated"] = l.mapKey(prefix + old)
+		}
+
+		l.bindings = append(l.bindings, &binding{
+			key:   l.mapKey(prefix + key),
+			opts:  opts,
+			field: field,
+			value: structVal.Field(i),
+		})
+	}
+}
+
+// isNested reports whether a field holds a struct that should be bound field by field
+// rather than coerced from a single value.
+func isNested(field reflect.StructField) bool {
+	if field.Type.Kind() != reflect.Struct || (!field.IsExported() && !field.Anonymous) {
+		return false
+	}
+
+	if coercesWhole(field.Type) {
+		return false
+	}
+
+	_, _, ok := nullable(reflect.New(field.Type).Elem())
+	return !ok
+}
+
+// mapKey passes key through the configured name mapper followed by the key normalizer,
+// if any.
+func (l *loader) mapKey(key string) string {
+	if l.opts.nameMapper != nil {
+		key = l.opts.nameMapper(key)
+	}
+
+	if l.opts.keyNormalizer != nil {
+		key = l.opts.keyNormalizer(key)
+	}
+
+	return key
+}
+
+// environList returns the environment's KEY=VALUE entries, as given by [WithEnviron] or
+// read from the live environment.
+func (l *loader) environList() []string {
+	if l.opts.environ != nil {
+		return l.opts.environ
+	}
+
+	return os.Environ()
+}
+
+// environ returns a lookup over the environment like [os.Getenv], see lookupEnv.
+func (l *loader) environ() func(string) string {
+	lookup := l.lookupEnv()
+	return func(key string) string {
+		val, _ := lookup(key)
+		return val
+	}
+}
+
+// lookupEnv returns a lookup over the environment like [os.LookupEnv]. When a name mapper
+// is configured the environment's keys are mapped too so they compare equal to binding
+// keys, and when case folding is enabled keys are compared in upper case.
+func (l *loader) lookupEnv() func(string) (string, bool) {
+	lookup := os.LookupEnv
+	fold := l.opts.foldEnvCase()
+	mapped := l.opts.nameMapper != nil || l.opts.keyNormalizer != nil
+	if mapped || l.opts.environ != nil || fold {
+		env := make(map[string]string)
+		for _, kv := range l.environList() {
+			key, val, _ := strings.Cut(kv, "=")
+			key = l.mapKey(key)
+			if fold {
+				key = strings.ToUpper(key)
+			}
+			env[key] = val
+		}
+
+		lookup = func(key string) (string, bool) {
+			if fold {
+				key = strings.ToUpper(key)
+			}
+
+			val, ok := env[key]
+			return val, ok
+		}
+	}
+
+	if !l.opts.trimEnv() {
+		return lookup
+	}
+
+	return func(key string) (string, bool) {
+		val, ok := lookup(key)
+		return strings.Trim(val, whitespace), ok
+	}
+}
+
+func (l *loader) warn(kind WarningKind, key, format string, args ...any) {
+	l.warnings = append(l.warnings, Warning{
+		Kind:    kind,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// log reports the event to the logger given by [WithLogger], if any.
+func (l *loader) log(event Event) {
+	if l.opts.logger != nil {
+		l.opts.logger(event)
+	}
+}
+
+// logApplied reports that key was set to val.
+func (l *loader) logApplied(key, raw string, val reflect.Value) {
+	event := Event{Kind: EventApplied, Key: key, Source: l.source, Raw: raw}
+	if val.CanInterface() {
+		event.Value = val.Interface()
+	}
+
+	l.log(event)
+}
+
+func (l *loader) warnDeprecated(b *binding, key string) {
+	l.warn(WarningDeprecatedKey, key, "key %q is deprecated, use %q instead", key, b.key)
+}
+
+// setValue coerces val into the binding's field and records where it came from.
+func (l *loader) setValue(b *binding, val string) error {
+	l.detach(b)
+	if setter := l.fieldSetter(b); setter != nil {
+		if err := setter(l.target, val); err != nil {
+			return fmt.Errorf("setting %q: %w", b.key, err)
+		}
+	} else if b.set && b.value.Kind() == reflect.Slice && b.opts["merge"] == "append" {
+		// slices with merge=append accumulate values from every source that sets them
+		// rather than the latest replacing the rest
+		appended := reflect.New(b.value.Type()).Elem()
+		if err := coerceValue(b, appended, val); err != nil {
+			return err
+		}
+		b.value.Set(reflect.AppendSlice(b.value, appended))
+	} else if err := coerceValue(b, b.value, val); err != nil {
+		return err
+	}
+
+	b.set = true
+	b.source = l.source
+	b.raw = val
+	l.recordRaw(b.key, val)
+	l.logApplied(b.key, val, b.value)
+	return nil
+}
+
+// fail records err as a failure to set key when collecting failures, returning nil so
+// applying carries on with the next key. Otherwise err is returned as is.
+func (l *loader) fail(key string, err error) error {
+	if !l.collect {
+		return err
+	}
+
+	failure := FieldError{Line: l.line, Key: key, Err: err}
+	if l.source != sourceEnv {
+		failure.File = l.source
+	}
+
+	l.failures = append(l.failures, failure)
+	return nil
+}
+
+// detach deep copies the binding's field the first time it's written to when loading
+// into a scratch copy, so the write can't reach the original target through a shared
+// map, slice or pointer. Fields no source writes to keep sharing their values.
+func (l *loader) detach(b *binding) {
+	if !l.scratch || b.detached {
+		return
+	}
+
+	copied := reflect.New(b.value.Type()).Elem()
+	deepCopy(copied, b.value)
+	b.value.Set(copied)
+	b.detached = true
+}
+
+// fieldSetter returns the setter given to [WithFieldSetter] for the binding's key, if
+// any.
+func (l *loader) fieldSetter(b *binding) func(any, string) error {
+	for key, setter := range l.opts.setters {
+		if l.mapKey(key) == b.key {
+			return setter
+		}
+	}
+
+	return nil
+}
+
+// recordRaw stores the raw value applied for key in the map given to [WithRawValues].
+func (l *loader) recordRaw(key, val string) {
+	if l.opts.rawValues != nil {
+		l.opts.rawValues[key] = val
+	}
+}
+
+func (l *loader) applyEnv() error {
+	l.source = sourceEnv
+	l.line = 0
+	lookup := l.lookupEnv()
+	getenv := l.environ()
+	for _, b := range l.bindings {
+		if b.captures() {
+			if err := l.captureEnv(b); err != nil {
+				return fmt.Errorf("applying env to %q: %w", l.name, err)
+			}
+			continue
+		}
+
+		val := getenv(b.key)
+		old, deprecated := b.opts["deprecated"]
+		if deprecated = deprecated && val == ""; deprecated {
+			val = getenv(old)
+		}
+
+		if b.opts.has("presence") {
+			// the field is true whenever the variable exists, whatever its value
+			_, found := lookup(b.key)
+			val, deprecated = "", false
+			if found {
+				val = "true"
+			}
+		}
+
+		l.log(Event{
+			Kind:   EventLookup,
+			Key:    b.key,
+			Source: l.source,
+			Found:  val != "",
+			Raw:    val,
+		})
+		if val == "" {
+			continue
+		}
+
+		if deprecated {
+			l.consumed[old] = true
+		} else {
+			l.consumed[b.key] = true
+		}
+
+		if err := l.setValue(b, l.sourceValue(b.key, val)); err != nil {
+			if err := l.fail(b.key, err); err != nil {
+				return fmt.Errorf("applying env to %q: %w", l.name, err)
+			}
+			continue
+		}
+
+		if deprecated {
+			l.warnDeprecated(b, old)
+		}
+	}
+
+	return nil
+}
+
+// captureEnv collects every environment variable prefixed by the binding's key into
+// its map field.
+func (l *loader) captureEnv(b *binding) error {
+	for _, env := range l.environList() {
+		key, val, _ := strings.Cut(env, "=")
+		if l.opts.trimEnv() {
+			val = strings.Trim(val, whitespace)
+		}
+
+		if val == "" {
+			continue
+		}
+
+		if suffix, ok := b.capture(l.mapKey(key)); ok {
+			l.consumed[key] = true
+			if err := l.setMapValue(b, suffix, l.sourceValue(l.mapKey(key), val)); err != nil {
+				if err := l.fail(key, err); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// setMapValue coerces val into the binding's map field under the given key, allocating
+// the map if needed.
+func (l *loader) setMapValue(b *binding, key, val string) error {
+	l.detach(b)
+	mapType := b.value.Type()
+	if b.value.Kind() != reflect.Map || mapType.Key().Kind() != reflect.String {
+		return fmt.Errorf(
+			"could not capture %q into %q: only maps with string keys are supported",
+			key,
+			b.field.Name,
+		)
+	}
+
+	elem := reflect.New(mapType.Elem()).Elem()
+	if err := coerceValue(b, elem, val); err != nil {
+		return err
+	}
+
+	if b.value.IsNil() {
+		b.value.Set(reflect.MakeMap(mapType))
+	}
+
+	b.value.SetMapIndex(reflect.ValueOf(key).Convert(mapType.Key()), elem)
+	b.set = true
+	b.source = l.source
+	l.recordRaw(b.key+key, val)
+	l.logApplied(b.key+key, val, elem)
+	return nil
+}
+
+func (l *loader) applyFile(fsys fs.FS, path string) error {
+	return l.readFile(fsys, path, l.applyReader)
+}
+
+// readFile opens path through fsys and passes its contents, decoded into UTF-8, to read.
+func (l *loader) readFile(fsys fs.FS, path string, read func(io.Reader) error) error {
+	file, err := fsys.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("parsing config file: %w: %w", ErrFileNotFound, err)
+	}
+
+	if err != nil {
+		return fmt.Errorf("parsing config file: %w", err)
+	}
+	defer file.Close()
+
+	rd, err := decodeBOM(file)
+	if err != nil {
+		return fmt.Errorf("decoding %q: %w", path, err)
+	}
+
+	l.source = path
+	if err := read(rd); err != nil {
+		return fmt.Errorf("applying %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// decodeBOM detects a leading byte order mark, skipping it for UTF-8 and transcoding
+// the rest of rd into UTF-8 for UTF-16. Without a byte order mark UTF-8 is assumed.
+func decodeBOM(rd io.Reader) (io.Reader, error) {
+	r := bufio.NewReader(rd)
+	bom, _ := r.Peek(3)
+	switch {
+	case bytes.HasPrefix(bom, []byte{0xEF, 0xBB, 0xBF}):
+		_, err := r.Discard(3)
+		return r, err
+	case bytes.HasPrefix(bom, []byte{0xFF, 0xFE}):
+		return decodeUTF16(r, binary.LittleEndian)
+	case bytes.HasPrefix(bom, []byte{0xFE, 0xFF}):
+		return decodeUTF16(r, binary.BigEndian)
+	default:
+		return r, nil
+	}
+}
+
+// decodeUTF16 transcodes UTF-16 with the given byte order, including its byte order
+// mark, into UTF-8.
+func decodeUTF16(rd io.Reader, order binary.ByteOrder) (io.Reader, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data)%2 != 0 {
+		return nil, errors.New("truncated UTF-16 data")
+	}
+
+	units := make([]uint16, 0, len(data)/2-1)
+	for i := 2; i < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+
+	return strings.NewReader(string(utf16.Decode(units))), nil
+}
+
+func (l *loader) applyReader(rd io.Reader) error {
+	return l.parseReader(rd, func(key, value, raw string) error {
+		return l.applyKeyValRaw(strings.TrimPrefix(key, l.opts.stripPrefix), value, raw)
+	})
+}
+
+// parseReader parses .env formatted config from rd, passing each key to apply along with
+// its processed value and its raw value as described by applyKeyValRaw.
+func (l *loader) parseReader(rd io.Reader, apply func(key, value, raw string) error) error {
+	r := bufio.NewReader(rd)
+	defer func() { l.line = 0 }()
+
+	var done bool
+	var lineNum int
+	var section string
+	for !done {
+		line, err := r.ReadBytes('\n')
+		lineNum++
+		l.line = lineNum
+		if err != nil {
+			if err != io.EOF {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			done = true
+		}
+
+		if strings.Trim(string(line), " \t\r\n") == sectionSeparator {
+			// sections are applied in order just like separate files, so later sections
+			// override keys set by earlier ones and don't inherit INI sections
+			section = ""
+			continue
+		}
+
+		if strings.HasPrefix(strings.TrimLeft(string(line), whitespace), l.opts.comment()) {
+			continue
+		}
+
+		if l.sections {
+			trimmed := strings.Trim(string(line), " \t\r\n")
+			if strings.HasPrefix(trimmed, ";") {
+				continue
+			}
+
+			if name, ok := cutSection(trimmed); ok {
+				section = strings.ToUpper(name) + "_"
+				continue
+			}
+		}
+
+		if key, marker, ok := cutHeredoc(string(line)); ok {
+			key = sectionKey(section, dottedKey(key))
+			val, lines, err := readHeredoc(r, marker)
+			lineNum += lines
+			if err != nil {
+				return fmt.Errorf("reading heredoc for %q: %w", key, err)
+			}
+
+			if err := apply(key, val, val); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key, val, found := strings.Cut(string(line), "=")
+		if !found {
+			// skip lines with bogus config values, only reporting them when linting
+			if l.lint && strings.Trim(string(line), " \t\r\n") != "" {
+				l.fail("", errors.New("expected KEY=VALUE"))
+			}
+			continue
+		}
+
+		key = sectionKey(section, dottedKey(strings.Trim(key, whitespace)))
+
+		raw := strings.TrimSuffix(val, "\n")
+		if l.opts.trimFiles() {
+			val = strings.Trim(val, whitespace)
+		} else {
+			val = raw
+		}
+
+		if err := apply(key, unquote(cutComment(val, l.opts.comment())), raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dottedKey translates .properties style keys like db.host into nested keys like DB_HOST.
+func dottedKey(key string) string {
+	if !strings.Contains(key, ".") {
+		return key
+	}
+
+	return strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// cutSection parses an INI section header of the form [name], returning the name.
+func cutSection(line string) (string, bool) {
+	name, ok := strings.CutPrefix(line, "[")
+	if !ok {
+		return "", false
+	}
+
+	name, ok = strings.CutSuffix(name, "]")
+	name = strings.Trim(name, whitespace)
+	return name, ok && name != ""
+}
+
+// sectionKey nests key under the INI section prefix, if any, upper casing it the same
+// way as dotted keys.
+func sectionKey(section, key string) string {
+	if section == "" {
+		return key
+	}
+
+	return section + strings.ToUpper(key)
+}
+
+// cutComment strips a trailing comment from val, e.g. 8080 # the http port. Comments
+// start with prefix, # by default, preceded by whitespace, so values like #fff or
+// http://host/#anchor are left intact, and must follow the closing quote of a quoted
+// value.
+func cutComment(val, prefix string) string {
+	var start int
+	if len(val) > 0 && (val[0] == '"' || val[0] == '\'') {
+		if end := strings.IndexByte(val[1:], val[0]); end >= 0 {
+			start = end + 2
+		}
+	}
+
+	for i := max(start, 1); i < len(val); i++ {
+		if strings.HasPrefix(val[i:], prefix) && (val[i-1] == ' ' || val[i-1] == '\t') {
+			return strings.TrimRight(val[:i], " \t")
+		}
+	}
+
+	return val
+}
+
+// unquote strips matching single or double quotes surrounding val.
+func unquote(val string) string {
+	if len(val) < 2 || val[0] != val[len(val)-1] || (val[0] != '"' && val[0] != '\'') {
+		return val
+	}
+
+	return val[1 : len(val)-1]
+}
+
+// cutHeredoc parses a heredoc opener of the form `KEY<<MARKER`, returning the key and
+// the marker that closes the block. Both must be single words, so lines like
+// `see docs << note` aren't mistaken for heredocs.
+func cutHeredoc(line string) (string, string, bool) {
+	key, marker, found := strings.Cut(line, "<<")
+	if !found || strings.Contains(key, "=") {
+		return "", "", false
+	}
+
+	key = strings.Trim(key, whitespace)
+	marker = strings.Trim(marker, " \t\r\n")
+	if key == "" || marker == "" || strings.ContainsAny(key+marker, " \t") {
+		return "", "", false
+	}
+
+	return key, marker, true
+}
+
+// readHeredoc accumulates lines up to the closing marker, returning the block along with
+// the number of lines read. Whitespace within the block is preserved, with only the final
+// line break before the marker removed. Blocks can't span a section separator.
+func readHeredoc(r *bufio.Reader, marker string) (string, int, error) {
+	var block strings.Builder
+	var lines int
+	for {
+		line, err := r.ReadString('\n')
+		lines++
+		if strings.TrimSpace(line) == marker {
+			return strings.TrimSuffix(block.String(), "\n"), lines, nil
+		}
+
+		if strings.TrimSpace(line) == sectionSeparator {
+			return "", lines, fmt.Errorf("section ended before closing marker %q", marker)
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return "", lines, fmt.Errorf("missing closing marker %q", marker)
+			}
+
+			return "", lines, err
+		}
+
+		block.WriteString(line)
+	}
+}
+
+func (l *loader) applyKeyVal(key, value string) error {
+	return l.applyKeyValRaw(key, value, value)
+}
+
+// applyKeyValRaw behaves like applyKeyVal, except fields with the `raw` option are set
+// to raw, the value exactly as it appeared in the source, without any trimming, quote or
+// comment processing, or interpolation.
+func (l *loader) applyKeyValRaw(key, value, raw string) error {
+	sourceKey := key
+	if l.namespace != "" {
+		var ok bool
+		if key, ok = strings.CutPrefix(key, l.namespace); !ok {
+			return nil
+		}
+	}
+
+	mapped := l.mapKey(key)
+	matched := slices.ContainsFunc(l.bindings, func(b *binding) bool {
+		_, captured := b.capture(mapped)
+		ok, _ := b.match(mapped)
+		return captured || ok
+	})
+
+	value = l.sourceValue(mapped, value)
+	l.log(Event{
+		Kind:   EventLookup,
+		Key:    key,
+		Source: l.source,
+		Found:  matched,
+		Raw:    value,
+	})
+	if !matched {
+		l.warn(WarningUnmatchedKey, key, "no field matches key %q", key)
+		return nil
+	}
+	l.consumed[sourceKey] = true
+
+	for _, b := range l.bindings {
+		val := value
+		if b.opts.has("raw") {
+			val = raw
+		}
+
+		if b.opts.has("presence") {
+			val = "true"
+		}
+
+		if suffix, ok := b.capture(mapped); ok {
+			if err := l.setMapValue(b, suffix, val); err != nil {
+				if err := l.fail(key, err); err != nil {
+					return fmt.Errorf("applying config to %q: %w", l.name, err)
+				}
+			}
+			continue
+		}
+
+		ok, deprecated := b.match(mapped)
+		if !ok {
+			continue
+		}
+
+		if err := l.setValue(b, val); err != nil {
+			if err := l.fail(key, err); err != nil {
+				return fmt.Errorf("applying config to %q: %w", l.name, err)
+			}
+			continue
+		}
+
+		if deprecated {
+			l.warnDeprecated(b, key)
+		}
+	}
+
+	return nil
+}
+
+// matchesSlice reports whether key configures a slice field other than a byte slice.
+func (l *loader) matchesSlice(key string) bool {
+	mapped := l.mapKey(key)
+	return slices.ContainsFunc(l.bindings, func(b *binding) bool {
+		ok, _ := b.match(mapped)
+		fieldType := b.field.Type
+		return ok && fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() != reflect.Uint8
+	})
+}
+
+// applyFallback consults the fallback function for fields that haven't been set by a
+// source and still hold their zero value.
+func (l *loader) applyFallback() error {
+	if l.opts.fallback == nil {
+		return nil
+	}
+
+	l.source = sourceFallback
+	for _, b := range l.bindings {
+		if b.set || b.captures() || !b.value.IsZero() {
+			continue
+		}
+
+		val, ok, err := l.resolve(b.key)
+		if err != nil {
+			return fmt.Errorf("applying fallback to %q: %w", l.name, err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := l.setValue(b, val); err != nil {
+			return fmt.Errorf("applying fallback to %q: %w", l.name, err)
+		}
+	}
+
+	return nil
+}
+
+// resolve calls the fallback function for key, giving up once the timeout given to
+// [WithResolveTimeout] passes. A fallback that times out is left running in the
+// background since it can't be interrupted.
+func (l *loader) resolve(key string) (string, bool, error) {
+	if l.opts.resolveTimeout <= 0 {
+		val, ok := l.opts.fallback(key)
+		return val, ok, nil
+	}
+
+	type resolved struct {
+		val string
+		ok  bool
+	}
+
+	// buffered so a fallback finishing after the timeout doesn't block forever
+	done := make(chan resolved, 1)
+	go func() {
+		val, ok := l.opts.fallback(key)
+		done <- resolved{val, ok}
+	}()
+
+	timer := time.NewTimer(l.opts.resolveTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res.val, res.ok, nil
+	case <-timer.C:
+		return "", false, fmt.Errorf(
+			"resolving %q: %w after %s",
+			key,
+			context.DeadlineExceeded,
+			l.opts.resolveTimeout,
+		)
+	}
+}
+
+// applyDefaults sets any fields that haven't been set by a source and still hold their
+// zero value to the value of their `default` tag option. Defaults are interpolated
+// before being applied.
+func (l *loader) applyDefaults() error {
+	l.source = sourceDefault
+	for _, b := range l.bindings {
+		def, ok := b.opts["default"]
+		if b.set || !ok || !b.value.IsZero() {
+			continue
+		}
+
+		def = l.interpolate(b.key, def)
+		if err := l.setValue(b, def); err != nil {
+			return fmt.Errorf("applying default to %q: %w", l.name, err)
+		}
+
+		if l.opts.defaultsFirst {
+			// sources applied afterwards should treat the field as unset
+			b.set = false
+			continue
+		}
+		l.warnDefault(b)
+	}
+
+	return nil
+}
+
+// warnDefaultsKept warns about every field still holding the default applied before
+// sources by [WithDefaultsFirst].
+func (l *loader) warnDefaultsKept() {
+	for _, b := range l.bindings {
+		if !b.set && b.source == sourceDefault {
+			l.warnDefault(b)
+		}
+	}
+}
+
+func (l *loader) warnDefault(b *binding) {
+	l.warn(WarningDefaultApplied, b.key, "applied default %q for key %q", b.raw, b.key)
+}
+
+// sourceValue interpolates the value of key from the environment or a config file when
+// [WithInterpolation] is given.
+func (l *loader) sourceValue(key, val string) string {
+	if !l.opts.interpolate {
+		return val
+	}
+
+	return l.interpolate(key, val)
+}
+
+// interpolate expands $KEY and ${KEY} references in val, the value of key. References
+// resolve to the raw value of a key that's already been set, falling back to the
+// environment. With [WithInterpolation] environment values are expanded in turn,
+// tracking the keys being resolved so cycles expand to an empty string.
+func (l *loader) interpolate(key, val string) string {
+	getenv := l.environ()
+	resolving := map[string]bool{key: true}
+	var resolve func(string) string
+	resolve = func(val string) string {
+		return expand(val, func(ref string) string {
+			key := l.mapKey(ref)
+			for _, b := range l.bindings {
+				if b.set && b.key == key {
+					return b.raw
+				}
+			}
+
+			envVal := getenv(key)
+			if !l.opts.interpolate {
+				return envVal
+			}
+
+			if resolving[key] {
+				return ""
+			}
+
+			resolving[key] = true
+			defer delete(resolving, key)
+			return resolve(envVal)
+		})
+	}
+
+	return resolve(val)
+}
+
+// expand behaves like [os.Expand] except $$ escapes a literal $. Unresolved references
+// expand to an empty string.
+func expand(val string, lookup func(string) string) string {
+	return os.Expand(val, func(ref string) string {
+		if ref == "$" {
+			return "$"
+		}
+
+		return lookup(ref)
+	})
+}
@@ -0,0 +1,68 @@
+package confetti
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DoubleUnderscoreToNested is a name mapper for use with [WithNameMapper] that
+// translates the double underscores commonly used in place of dots, e.g. when a
+// platform like Kubernetes won't allow dots in env var names, into confetti's nested key
+// convention. This lets DB__HOST configure the HOST field of a struct field tagged
+// `conf:"DB"`.
+func DoubleUnderscoreToNested(key string) string {
+	return strings.ReplaceAll(key, "__", "_")
+}
+
+// NormalizeHyphens is a key normalizer for use with [WithKeyNormalizer] that replaces
+// hyphens with underscores and upper cases the result, so file keys like max-conns
+// match fields tagged `conf:"MAX_CONNS"`.
+func NormalizeHyphens(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// CamelToScreamingSnake is a name mapper for use with [WithNameMapper] that translates
+// CamelCase keys into SCREAMING_SNAKE_CASE, so untagged fields like MaxConnections are
+// configured by MAX_CONNECTIONS. Acronyms are kept together, e.g. HTTPServer becomes
+// HTTP_SERVER, and keys that are already SCREAMING_SNAKE_CASE are left as is.
+func CamelToScreamingSnake(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				b.WriteRune('_')
+			}
+		}
+
+		b.WriteRune(unicode.ToUpper(r))
+	}
+
+	return b.String()
+}
+
+// SnakeToCamel is a name mapper for use with [WithNameMapper] that translates snake_case
+// and SCREAMING_SNAKE_CASE keys into CamelCase, so keys like max_connections in a config
+// file configure untagged fields like MaxConnections. Keys that are already CamelCase
+// are left as is.
+func SnakeToCamel(key string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(key, "_") {
+		if part == "" {
+			continue
+		}
+
+		if part == strings.ToUpper(part) || part == strings.ToLower(part) {
+			part = strings.ToLower(part)
+		}
+
+		first, size := utf8.DecodeRuneInString(part)
+		b.WriteRune(unicode.ToUpper(first))
+		b.WriteString(part[size:])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package confetti_test
+
+import (
+	"testing"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoubleUnderscoreToNested(t *testing.T) {
+	type mapperDBConfig struct {
+		Host string `conf:"HOST"`
+		Port int    `conf:"PORT"`
+	}
+
+	type doubleUnderscoreConfig struct {
+		DB      mapperDBConfig `conf:"MAPPER_DB"`
+		MaxConn int            `conf:"MAPPER_MAX_CONN"`
+	}
+
+	t.Setenv("MAPPER_DB__HOST", "db.internal")
+	t.Setenv("MAPPER_MAX_CONN", "10")
+	path := writeFile(t, ".env", "MAPPER_DB__PORT=5432")
+
+	cfg, _, err := confetti.Load[doubleUnderscoreConfig](
+		confetti.WithFiles(path),
+		confetti.WithNameMapper(confetti.DoubleUnderscoreToNested),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, "db.internal", cfg.DB.Host)
+	require.Equal(t, 5432, cfg.DB.Port)
+	require.Equal(t, 10, cfg.MaxConn)
+}
+
+func TestCamelToScreamingSnake(t *testing.T) {
+	cases := map[string]string{
+		"MaxConnections":  "MAX_CONNECTIONS",
+		"MAX_CONNECTIONS": "MAX_CONNECTIONS",
+		"HTTPServer":      "HTTP_SERVER",
+		"DB_MaxConn":      "DB_MAX_CONN",
+		"Retry2Times":     "RETRY2_TIMES",
+	}
+
+	for in, out := range cases {
+		require.Equal(t, out, confetti.CamelToScreamingSnake(in), in)
+	}
+
+	type camelConfig struct {
+		MaxConnections int
+	}
+
+	t.Setenv("MAX_CONNECTIONS", "10")
+	cfg, _, err := confetti.Load[camelConfig](confetti.WithNameMapper(confetti.CamelToScreamingSnake))
+	require.NoError(t, err)
+	require.Equal(t, 10, cfg.MaxConnections)
+}
+
+func TestSnakeToCamel(t *testing.T) {
+	cases := map[string]string{
+		"MAX_CONNECTIONS": "MaxConnections",
+		"max_connections": "MaxConnections",
+		"MaxConnections":  "MaxConnections",
+		"DB_MaxConn":      "DbMaxConn",
+	}
+
+	for in, out := range cases {
+		require.Equal(t, out, confetti.SnakeToCamel(in), in)
+	}
+
+	type snakeConfig struct {
+		MaxConnections int
+	}
+
+	path := writeFile(t, ".env", "max_connections=10")
+	cfg, _, err := confetti.Load[snakeConfig](
+		confetti.WithFiles(path),
+		confetti.WithNameMapper(confetti.SnakeToCamel),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 10, cfg.MaxConnections)
+}
+
+func TestNormalizeHyphens(t *testing.T) {
+	type connConfig struct {
+		MaxConns int    `conf:"MAX_CONNS"`
+		Host     string `conf:"db-host"`
+	}
+
+	path := writeFile(t, ".env", "max-conns=10\nDB_HOST=file")
+	cfg, _, err := confetti.Load[connConfig](
+		confetti.WithFiles(path),
+		confetti.WithKeyNormalizer(confetti.NormalizeHyphens),
+	)
+	require.NoError(t, err)
+	require.Equal(t, connConfig{MaxConns: 10, Host: "file"}, cfg)
+
+	cfg, _, err = confetti.Load[connConfig](
+		confetti.WithEnviron([]string{"MAX_CONNS=20", "db-host=env"}),
+		confetti.WithKeyNormalizer(confetti.NormalizeHyphens),
+	)
+	require.NoError(t, err)
+	require.Equal(t, connConfig{MaxConns: 20, Host: "env"}, cfg)
+}
+
+func TestCamelToScreamingSnakeUnexported(t *testing.T) {
+	type camelConfig struct {
+		Host string
+		home string
+	}
+
+	cfg, _, err := confetti.Load[camelConfig](
+		confetti.WithEnviron([]string{"HOST=localhost", "HOME=/root"}),
+		confetti.WithNameMapper(confetti.CamelToScreamingSnake),
+		confetti.WithEnvCaseFolding(true),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "localhost", cfg.Host)
+	require.Empty(t, cfg.home)
+}
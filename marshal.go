@@ -0,0 +1,207 @@
+package confetti
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Marshal renders v, a struct or a pointer to one, in the .env format understood by
+// [ApplyFiles]. Each field is written using its config key, and values spanning
+// multiple lines are written as heredocs.
+func Marshal(v any) ([]byte, error) {
+	return marshal(v, false)
+}
+
+// MarshalChanged behaves like [Marshal] but only writes fields whose value differs from
+// their `default` tag option, or from their zero value when they have no default. This
+// produces a minimal override file.
+func MarshalChanged(v any) ([]byte, error) {
+	return marshal(v, true)
+}
+
+// ToMap returns the config keys of v, a struct or a pointer to one, mapped to their
+// values formatted the same way as [Marshal]. This is suitable for exposing the
+// effective config on a debug endpoint. Fields with the `secret` tag option are masked
+// unless [WithOmitSecrets] is given, in which case they're left out entirely.
+func ToMap(v any, opts ...Option) (map[string]string, error) {
+	o := newOptions(opts...)
+	entries, err := marshalEntries(v, false)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		switch {
+		case !entry.binding.opts.has("secret"):
+			m[entry.key] = entry.val
+		case !o.omitSecrets:
+			m[entry.key] = secretMask
+		}
+	}
+
+	return m, nil
+}
+
+// secretMask replaces the values of secret fields in [ToMap].
+const secretMask = "******"
+
+func marshal(v any, changedOnly bool) ([]byte, error) {
+	entries, err := marshalEntries(v, changedOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		writeEntry(&buf, entry.key, entry.val, !entry.binding.opts.has("raw"))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// marshalEntry is a single formatted key/value pair of a marshaled struct.
+type marshalEntry struct {
+	binding  *binding
+	key, val string
+}
+
+func marshalEntries(v any, changedOnly bool) ([]marshalEntry, error) {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer {
+		ptr := reflect.New(target.Type())
+		ptr.Elem().Set(target)
+		target = ptr
+	}
+
+	l, err := newLoader(target.Interface(), newOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []marshalEntry
+	for _, b := range l.bindings {
+		if !b.field.IsExported() {
+			continue
+		}
+
+		if changedOnly {
+			isDefault, err := b.isDefault()
+			if err != nil {
+				return nil, fmt.Errorf("marshaling %q: %w", l.name, err)
+			}
+
+			if isDefault {
+				continue
+			}
+		}
+
+		if b.pattern != nil {
+			// keys collected by a pattern can't be reconstructed from the map's keys
+			continue
+		}
+
+		if b.opts.has("capture") {
+			var captured []marshalEntry
+			iter := b.value.MapRange()
+			for iter.Next() {
+				captured = append(captured, marshalEntry{
+					binding: b,
+					key:     b.key + iter.Key().String(),
+					val:     formatValue(b, iter.Value()),
+				})
+			}
+
+			slices.SortFunc(captured, func(a, b marshalEntry) int {
+				return strings.Compare(a.key, b.key)
+			})
+			entries = append(entries, captured...)
+			continue
+		}
+
+		if _, valid, ok := nullable(b.value); ok && !valid.Bool() {
+			continue
+		}
+
+		entries = append(entries, marshalEntry{
+			binding: b,
+			key:     b.key,
+			val:     formatValue(b, b.value),
+		})
+	}
+
+	return entries, nil
+}
+
+// isDefault reports whether the bound field holds the value of its `default` tag
+// option, or its zero value if it doesn't have one.
+func (b *binding) isDefault() (bool, error) {
+	def, ok := b.opts["default"]
+	if !ok {
+		return b.value.IsZero(), nil
+	}
+
+	defVal := reflect.New(b.value.Type()).Elem()
+	if err := coerceValue(b, defVal, expand(def, os.Getenv)); err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(defVal.Interface(), b.value.Interface()), nil
+}
+
+// writeEntry writes a single key/value pair, falling back to a heredoc for values that
+// span multiple lines or that no quoting can protect. Values are quoted if needed unless
+// quoting is false, as for fields with the `raw` option that are read back verbatim.
+func writeEntry(buf *bytes.Buffer, key, val string, quoting bool) {
+	if !strings.Contains(val, "\n") {
+		line, ok := val, true
+		if quoting {
+			line, ok = quote(val)
+		}
+
+		if ok {
+			fmt.Fprintf(buf, "%s=%s\n", key, line)
+			return
+		}
+	}
+
+	// the reader ends the block at any line equal to the marker once trimmed
+	marker := "EOF"
+	for slices.ContainsFunc(strings.Split(val, "\n"), func(line string) bool {
+		return strings.TrimSpace(line) == marker
+	}) {
+		marker += "_"
+	}
+
+	fmt.Fprintf(buf, "%s<<%s\n%s\n%s\n", key, marker, val, marker)
+}
+
+// quote wraps val in quotes when it would otherwise be read back differently, i.e. when
+// it contains something that looks like a comment, has surrounding whitespace or is
+// already wrapped in quotes. It reports false if neither quote character reads back as
+// val, leaving the caller to write it some other way.
+func quote(val string) (string, bool) {
+	quotes := []string{"", `"`, "'"}
+	if strings.Contains(val, `"`) {
+		// prefer the quote character that doesn't appear in val
+		quotes = []string{"", "'", `"`}
+	}
+
+	for _, q := range quotes {
+		if quoted := q + val + q; readsBack(quoted, val) {
+			return quoted, true
+		}
+	}
+
+	return "", false
+}
+
+// readsBack reports whether line is read back as val when it follows KEY=.
+func readsBack(line, val string) bool {
+	line = strings.Trim(line, whitespace)
+	return unquote(cutComment(line, defaultCommentPrefix)) == val
+}
@@ -0,0 +1,148 @@
+package confetti_test
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+type marshalConfig struct {
+	Host     string            `conf:"MARSHAL_HOST,default=localhost"`
+	Port     int               `conf:"MARSHAL_PORT,default=8080"`
+	Timeout  time.Duration     `conf:"MARSHAL_TIMEOUT,default=5s"`
+	Tags     []string          `conf:"MARSHAL_TAGS,default=a,b"`
+	Debug    bool              `conf:"MARSHAL_DEBUG"`
+	Script   string            `conf:"MARSHAL_SCRIPT"`
+	Name     sql.NullString    `conf:"MARSHAL_NAME"`
+	Features map[string]string `conf:"MARSHAL_FEATURE_,capture"`
+}
+
+func TestMarshal(t *testing.T) {
+	cfg := marshalConfig{
+		Host:     "example.com",
+		Port:     8080,
+		Timeout:  time.Minute,
+		Tags:     []string{"a", "b"},
+		Debug:    true,
+		Script:   "echo hi\nexit 0",
+		Features: map[string]string{"SEARCH": "on", "BILLING": "off"},
+	}
+
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+	require.Equal(t, `MARSHAL_HOST=example.com
+MARSHAL_PORT=8080
+MARSHAL_TIMEOUT=1m0s
+MARSHAL_TAGS=a,b
+MARSHAL_DEBUG=true
+MARSHAL_SCRIPT<<EOF
+echo hi
+exit 0
+EOF
+MARSHAL_FEATURE_BILLING=off
+MARSHAL_FEATURE_SEARCH=on
+`, string(out))
+
+	// marshaled output round trips
+	roundTrip := marshalConfig{}
+	err = confetti.ApplyReader(&roundTrip, strings.NewReader(string(out)))
+	require.NoError(t, err)
+	require.Equal(t, cfg, roundTrip)
+}
+
+func TestMarshalChanged(t *testing.T) {
+	cfg, _, err := confetti.Load[marshalConfig]()
+	require.NoError(t, err)
+
+	out, err := confetti.MarshalChanged(&cfg)
+	require.NoError(t, err)
+	require.Empty(t, string(out))
+
+	cfg.Port = 9090
+	cfg.Debug = true
+	cfg.Name = sql.NullString{String: "test", Valid: true}
+
+	out, err = confetti.MarshalChanged(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, "MARSHAL_PORT=9090\nMARSHAL_DEBUG=true\nMARSHAL_NAME=test\n", string(out))
+}
+
+func TestToMap(t *testing.T) {
+	type mapConfig struct {
+		Host     string        `conf:"TOMAP_HOST"`
+		Password string        `conf:"TOMAP_PASSWORD,secret"`
+		Timeout  time.Duration `conf:"TOMAP_TIMEOUT"`
+		DB       struct {
+			Port int `conf:"PORT"`
+		} `conf:"TOMAP_DB"`
+		Untagged bool
+	}
+
+	cfg := mapConfig{Host: "localhost", Password: "hunter2", Timeout: time.Second}
+	cfg.DB.Port = 5432
+
+	m, err := confetti.ToMap(cfg)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"TOMAP_HOST":     "localhost",
+		"TOMAP_PASSWORD": "******",
+		"TOMAP_TIMEOUT":  "1s",
+		"TOMAP_DB_PORT":  "5432",
+		"Untagged":       "false",
+	}, m)
+
+	m, err = confetti.ToMap(&cfg, confetti.WithOmitSecrets())
+	require.NoError(t, err)
+	require.NotContains(t, m, "TOMAP_PASSWORD")
+	require.Len(t, m, 4)
+}
+
+func TestMarshalQuotes(t *testing.T) {
+	type quoteConfig struct {
+		Comment string `conf:"COMMENT"`
+		Quoted  string `conf:"QUOTED"`
+		Color   string `conf:"COLOR"`
+		Padded  string `conf:"PADDED"`
+		Mixed   string `conf:"MIXED"`
+	}
+
+	cfg := quoteConfig{
+		Comment: "a # b",
+		Quoted:  `"quoted"`,
+		Color:   "#fff",
+		Padded:  " padded\t",
+		Mixed:   `it's "a" # b`,
+	}
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"COMMENT=\"a # b\"\nQUOTED='\"quoted\"'\nCOLOR=#fff\nPADDED=\" padded\t\"\n"+
+			"MIXED<<EOF\nit's \"a\" # b\nEOF\n",
+		string(out),
+	)
+
+	var parsed quoteConfig
+	require.NoError(t, confetti.ApplyReader(&parsed, bytes.NewReader(out)))
+	require.Equal(t, cfg, parsed)
+}
+
+func TestMarshalHeredocMarker(t *testing.T) {
+	type scriptConfig struct {
+		Script string `conf:"SCRIPT"`
+	}
+
+	cfg := scriptConfig{Script: "a\n  EOF\nb"}
+	out, err := confetti.Marshal(cfg)
+	require.NoError(t, err)
+	require.Equal(t, "SCRIPT<<EOF_\na\n  EOF\nb\nEOF_\n", string(out))
+
+	var parsed scriptConfig
+	require.NoError(t, confetti.ApplyReader(&parsed, bytes.NewReader(out)))
+	require.Equal(t, cfg, parsed)
+}
@@ -0,0 +1,303 @@
+package confetti
+
+import (
+	"io/fs"
+	"runtime"
+	"time"
+)
+
+// An Option configures how config is sourced by [Load] and its relatives.
+type Option func(*options)
+
+type options struct {
+	files            []string
+	filesOverrideEnv bool
+	atomic           bool
+	nameMapper       func(string) string
+	keyNormalizer    func(string) string
+	tagNames         []string
+	requireTag       bool
+	setters          map[string]func(any, string) error
+	commentPrefix    string
+	resolveTimeout   time.Duration
+	trimSpace        *bool
+	omitSecrets      bool
+	fallback         func(string) (string, bool)
+	rawValues        map[string]string
+	interpolate      bool
+	exclusive        [][]string
+	together         [][]string
+	logger           func(Event)
+	environ          []string
+	foldEnv          *bool
+	stripPrefix      string
+	defaultsFirst    bool
+	fsys             fs.FS
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// filesFS returns the filesystem files given to [WithFiles] are read from.
+func (o *options) filesFS() fs.FS {
+	if o.fsys == nil {
+		return osFS{}
+	}
+
+	return o.fsys
+}
+
+func (o *options) trimEnv() bool {
+	return o.trimSpace != nil && *o.trimSpace
+}
+
+func (o *options) trimFiles() bool {
+	return o.trimSpace == nil || *o.trimSpace
+}
+
+func (o *options) foldEnvCase() bool {
+	if o.foldEnv == nil {
+		return runtime.GOOS == "windows"
+	}
+
+	return *o.foldEnv
+}
+
+// defaultCommentPrefix starts comments in config files unless [WithCommentPrefix] is
+// given.
+const defaultCommentPrefix = "#"
+
+func (o *options) comment() string {
+	if o.commentPrefix == "" {
+		return defaultCommentPrefix
+	}
+
+	return o.commentPrefix
+}
+
+// WithFiles adds .env formatted files to be applied by [Load]. Files are applied in
+// order with the latter taking precedence.
+func WithFiles(paths ...string) Option {
+	return func(o *options) {
+		o.files = append(o.files, paths...)
+	}
+}
+
+// WithFilesOverrideEnv makes [Load] apply files after the environment so that values
+// from files take precedence over environment variables.
+func WithFilesOverrideEnv() Option {
+	return func(o *options) {
+		o.filesOverrideEnv = true
+	}
+}
+
+// WithAtomic makes [LoadInto] apply config to a copy of the target, only committing it
+// back once every source has been applied successfully. A failure part way through
+// leaves the target untouched.
+func WithAtomic() Option {
+	return func(o *options) {
+		o.atomic = true
+	}
+}
+
+// WithNameMapper transforms keys before they're matched. The mapper is applied to field
+// keys as well as the keys found in files and the environment so both sides compare
+// consistently. For example, [strings.ToUpper] allows a lowercase file key like
+// `db_host` to match a field tagged `conf:"DB_HOST"`.
+func WithNameMapper(mapper func(string) string) Option {
+	return func(o *options) {
+		o.nameMapper = mapper
+	}
+}
+
+// WithKeyNormalizer rewrites keys into a canonical form before they're matched, so
+// differently spelled keys configure the same field. Like a name mapper it's applied to
+// field keys as well as the keys found in files and the environment, after any mapper
+// given to [WithNameMapper]. [NormalizeHyphens] makes max-conns and MAX_CONNS
+// interchangeable.
+func WithKeyNormalizer(normalizer func(string) string) Option {
+	return func(o *options) {
+		o.keyNormalizer = normalizer
+	}
+}
+
+// WithFieldSetter hands values for key to setter instead of coercing them into the
+// matching field, giving full control over how it's set. The setter is called with the
+// target being loaded and the value as it would otherwise be coerced. Any error it
+// returns fails loading like a value that couldn't be coerced.
+func WithFieldSetter(key string, setter func(target any, raw string) error) Option {
+	return func(o *options) {
+		if o.setters == nil {
+			o.setters = make(map[string]func(any, string) error)
+		}
+		o.setters[key] = setter
+	}
+}
+
+// WithTagNames sets the struct tags consulted for keys and tag options, checked in
+// order for every field. The first tag present on a field is used. This is helpful
+// when migrating structs that mix `conf` with another library's tags, e.g.
+// WithTagNames("conf", "env"). Defaults to just `conf`.
+func WithTagNames(names ...string) Option {
+	return func(o *options) {
+		o.tagNames = names
+	}
+}
+
+// WithRequireTag makes fields only match keys given explicitly by their tag, rather than
+// falling back to the struct field name for untagged fields, which are ignored instead.
+// Embedded structs and fields with the `inline` option still have their fields promoted.
+func WithRequireTag() Option {
+	return func(o *options) {
+		o.requireTag = true
+	}
+}
+
+// WithTrimSpace controls whether surrounding whitespace is trimmed from values. By
+// default values from files are trimmed while environment values are used as is, so an
+// env var with a trailing space keeps it. WithTrimSpace(true) trims values from every
+// source and WithTrimSpace(false) trims none of them. Heredoc values are never trimmed.
+func WithTrimSpace(trim bool) Option {
+	return func(o *options) {
+		o.trimSpace = &trim
+	}
+}
+
+// WithOmitSecrets makes [ToMap] leave out fields with the `secret` tag option rather
+// than masking their values.
+func WithOmitSecrets() Option {
+	return func(o *options) {
+		o.omitSecrets = true
+	}
+}
+
+// WithFallback sets a function consulted as a last resort for fields that no source
+// provided a value for, e.g. to query a remote config server. It's called with each
+// unset field's key before defaults are applied and should report false if it doesn't
+// have a value, leaving the field to its default.
+func WithFallback(fallback func(key string) (string, bool)) Option {
+	return func(o *options) {
+		o.fallback = fallback
+	}
+}
+
+// WithResolveTimeout bounds how long each call to the [WithFallback] function may take,
+// so a hung config server can't block startup. Loading fails with an error naming the
+// key and wrapping [context.DeadlineExceeded] once a call runs past timeout.
+func WithResolveTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.resolveTimeout = timeout
+	}
+}
+
+// WithRawValues records the raw string applied to each field in m, keyed by config key,
+// before it's coerced. Values are recorded as they're applied, so a key set by several
+// sources ends up holding the value that took precedence. This is useful for auditing
+// exactly what config was provided.
+func WithRawValues(m map[string]string) Option {
+	return func(o *options) {
+		o.rawValues = m
+	}
+}
+
+// WithInterpolation expands $KEY and ${KEY} references in values from the environment
+// and config files the same way as defaults. References to environment variables are
+// followed through chains, so given BASE=${HOST}:8080 and HOST=localhost a value of
+// ${BASE}/api expands to localhost:8080/api. Missing and cyclic references expand to an
+// empty string.
+func WithInterpolation() Option {
+	return func(o *options) {
+		o.interpolate = true
+	}
+}
+
+// WithMutuallyExclusive makes loading fail if more than one of the given keys is set by
+// a source, e.g. WithMutuallyExclusive("TLS_CERT_FILE", "TLS_CERT_INLINE"). Defaults
+// don't count towards the check. It may be given several times to declare separate
+// groups.
+func WithMutuallyExclusive(keys ...string) Option {
+	return func(o *options) {
+		o.exclusive = append(o.exclusive, keys)
+	}
+}
+
+// WithRequiredTogether makes loading fail if some but not all of the given keys are set
+// by a source, e.g. WithRequiredTogether("DB_USER", "DB_PASS", "DB_HOST"). Like
+// [WithMutuallyExclusive], defaults don't count towards the check and it may be given
+// several times.
+func WithRequiredTogether(keys ...string) Option {
+	return func(o *options) {
+		o.together = append(o.together, keys)
+	}
+}
+
+// WithLogger calls logger with an [Event] for each step taken while applying config,
+// like looking up a key or setting a field. This helps troubleshoot why a field did or
+// didn't end up with a particular value.
+func WithLogger(logger func(Event)) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// withFS reads files given to [WithFiles] from fsys instead of the real filesystem.
+func withFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.fsys = fsys
+	}
+}
+
+// WithEnviron reads environment variables from environ, a slice of KEY=VALUE entries
+// like the output of [os.Environ], instead of the live environment. This makes loading
+// config reproducible in tests and sandboxes.
+func WithEnviron(environ []string) Option {
+	return func(o *options) {
+		o.environ = environ
+	}
+}
+
+// WithEnvCaseFolding controls whether environment variables are matched regardless of
+// case, so PATH, Path and path all configure a field keyed PATH. This mirrors how
+// Windows treats environment variables, so it's enabled by default on Windows and
+// disabled everywhere else. Case folding doesn't apply to `capture` fields.
+func WithEnvCaseFolding(fold bool) Option {
+	return func(o *options) {
+		o.foldEnv = &fold
+	}
+}
+
+// WithStripPrefix strips prefix from keys in config files before matching them, so files
+// that prefix every key with e.g. APP_ can configure fields with unprefixed keys. Keys
+// without the prefix are matched as they are.
+func WithStripPrefix(prefix string) Option {
+	return func(o *options) {
+		o.stripPrefix = prefix
+	}
+}
+
+// WithDefaultsFirst makes [Load] apply `default` tag options before any source rather
+// than afterwards, letting files and the environment override them like any other value.
+// Since sources haven't been applied yet, defaults can only reference environment
+// variables, and the [WithFallback] function isn't consulted for fields with a default.
+// Defaults still don't count as set for [WithMutuallyExclusive] and
+// [WithRequiredTogether].
+func WithDefaultsFirst() Option {
+	return func(o *options) {
+		o.defaultsFirst = true
+	}
+}
+
+// WithCommentPrefix sets what starts a comment in config files, in place of #, e.g. ;
+// or //. Comments still either take up a whole line or follow whitespace, and # is then
+// treated like any other character.
+func WithCommentPrefix(prefix string) Option {
+	return func(o *options) {
+		o.commentPrefix = prefix
+	}
+}
@@ -0,0 +1,137 @@
+package confetti
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"strings"
+)
+
+// ParseFiles parses .env formatted files into a map of keys to values without applying
+// them to a struct. Files are parsed the same way as [ApplyFiles], with comments and
+// quotes stripped, and applied in order with the latter taking precedence. Values are
+// interpolated like defaults, with $KEY and ${KEY} resolving to keys parsed earlier,
+// falling back to the environment.
+func ParseFiles(paths ...string) (map[string]string, error) {
+	return parseFiles(true, paths...)
+}
+
+// parseFiles parses paths into a map, interpolating values if interpolate is true.
+func parseFiles(interpolate bool, paths ...string) (map[string]string, error) {
+	l, m, set := newParser(interpolate)
+	for _, path := range paths {
+		err := l.readFile(osFS{}, path, func(rd io.Reader) error {
+			return l.parseReader(rd, set)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Lint checks the syntax of the .env formatted file at path without applying it to a
+// struct. Lines that aren't comments, heredocs or KEY=VALUE pairs are reported, as are
+// pairs with an empty key or an unterminated quote. Every problem found is returned
+// together as a [*MultiError] with the line it's on.
+func Lint(path string) error {
+	l := &loader{opts: newOptions(), lint: true, collect: true}
+	err := l.readFile(osFS{}, path, func(rd io.Reader) error {
+		return l.parseReader(rd, func(key, _, raw string) error {
+			if key == "" {
+				l.fail(key, errors.New("missing key"))
+			}
+
+			if unterminated(strings.Trim(raw, " \t\r")) {
+				l.fail(key, errors.New("unterminated quote"))
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(l.failures) > 0 {
+		return &MultiError{Errors: l.failures}
+	}
+
+	return nil
+}
+
+// unterminated reports whether val opens a quote that it never closes.
+func unterminated(val string) bool {
+	if val == "" || (val[0] != '"' && val[0] != '\'') {
+		return false
+	}
+
+	return strings.IndexByte(val[1:], val[0]) < 0
+}
+
+// ParseReader parses .env formatted config from r the same way as [ParseFiles].
+func ParseReader(r io.Reader) (map[string]string, error) {
+	l, m, set := newParser(true)
+	if err := l.parseReader(r, set); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// newParser returns a loader that isn't bound to any fields along with the map parsed
+// keys are stored in and the function that stores them.
+func newParser(interpolate bool) (*loader, map[string]string, func(key, value, raw string) error) {
+	l := &loader{opts: newOptions(), source: sourceReader}
+	m := make(map[string]string)
+	set := func(key, value, _ string) error {
+		if !interpolate {
+			m[key] = value
+			return nil
+		}
+
+		m[key] = expand(value, func(ref string) string {
+			if val, ok := m[ref]; ok {
+				return val
+			}
+
+			return os.Getenv(ref)
+		})
+		return nil
+	}
+
+	return l, m, set
+}
+
+// ParseEnv returns every environment variable as a map of keys to values, for use
+// alongside [ParseFiles] when config doesn't live in a struct.
+func ParseEnv() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, val, _ := strings.Cut(kv, "=")
+		env[key] = val
+	}
+
+	return env
+}
+
+// MergeMaps layers the given maps into a new one, with later maps taking precedence.
+// Layering the results of [ParseFiles] and [ParseEnv] in that order mirrors the
+// precedence used by [Load]:
+//
+//	files, err := confetti.ParseFiles(".env", ".secret")
+//	if err != nil {
+//		return err
+//	}
+//
+//	config := confetti.MergeMaps(files, confetti.ParseEnv())
+func MergeMaps(layers ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, layer := range layers {
+		maps.Copy(merged, layer)
+	}
+
+	return merged
+}
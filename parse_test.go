@@ -0,0 +1,107 @@
+package confetti_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReader(t *testing.T) {
+	t.Setenv("PARSE_HOME", "/home/confetti")
+
+	content := `# parsed without a struct
+HOST=localhost # inline comment
+PORT="8080"
+URL=http://${HOST}:$PORT/api
+DATA=$PARSE_HOME/data
+PRICE=$$5
+db.name=app
+SCRIPT<<EOF
+echo "# kept"
+EOF`
+
+	m, err := confetti.ParseReader(strings.NewReader(content))
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{
+		"HOST":    "localhost",
+		"PORT":    "8080",
+		"URL":     "http://localhost:8080/api",
+		"DATA":    "/home/confetti/data",
+		"PRICE":   "$5",
+		"DB_NAME": "app",
+		"SCRIPT":  `echo "# kept"`,
+	}, m)
+}
+
+func TestParseFiles(t *testing.T) {
+	base := writeFile(t, "base.env", "HOST=localhost\nPORT=8080")
+	override := writeFile(t, "override.env", "PORT=9090\nADDR=${HOST}:${PORT}")
+
+	m, err := confetti.ParseFiles(base, override)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"HOST": "localhost",
+		"PORT": "9090",
+		"ADDR": "localhost:9090",
+	}, m)
+
+	_, err = confetti.ParseFiles(base, override+".missing")
+	require.ErrorIs(t, err, confetti.ErrFileNotFound)
+}
+
+func TestMergeMaps(t *testing.T) {
+	t.Setenv("MERGE_HOST", "env.local")
+	t.Setenv("MERGE_EMPTY", "")
+
+	files, err := confetti.ParseReader(strings.NewReader("MERGE_HOST=file.local\nMERGE_PORT=8080"))
+	require.NoError(t, err)
+
+	env := confetti.ParseEnv()
+	require.Equal(t, "env.local", env["MERGE_HOST"])
+	require.Contains(t, env, "MERGE_EMPTY")
+
+	merged := confetti.MergeMaps(files, env)
+	require.Equal(t, "env.local", merged["MERGE_HOST"])
+	require.Equal(t, "8080", merged["MERGE_PORT"])
+	require.Equal(t, "file.local", files["MERGE_HOST"])
+}
+
+func TestLint(t *testing.T) {
+	valid := writeFile(t, "valid.env", `# a comment
+HOST=localhost # trailing comment
+NAME="quoted # value"
+
+---
+CERT<<EOF
+-----BEGIN CERTIFICATE-----
+EOF
+`)
+	require.NoError(t, confetti.Lint(valid))
+
+	invalid := writeFile(t, "invalid.env", `HOST=localhost
+this line is bogus
+=orphaned
+NAME="unterminated
+PORT=8080`)
+
+	err := confetti.Lint(invalid)
+	var multi *confetti.MultiError
+	require.ErrorAs(t, err, &multi)
+	require.Len(t, multi.Errors, 3)
+	require.Equal(t, []int{2, 3, 4}, []int{
+		multi.Errors[0].Line,
+		multi.Errors[1].Line,
+		multi.Errors[2].Line,
+	})
+	require.Equal(t, invalid, multi.Errors[0].File)
+	require.ErrorContains(t, multi.Errors[0], "expected KEY=VALUE")
+	require.ErrorContains(t, multi.Errors[1], "missing key")
+	require.Equal(t, "NAME", multi.Errors[2].Key)
+	require.ErrorContains(t, multi.Errors[2], "unterminated quote")
+
+	require.ErrorIs(t, confetti.Lint(filepath.Join(t.TempDir(), "missing.env")), confetti.ErrFileNotFound)
+}
@@ -0,0 +1,42 @@
+package confetti
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// types holds the config struct types added with [RegisterType], keyed by name.
+var (
+	typesMu sync.RWMutex
+	types   = make(map[string]reflect.Type)
+)
+
+// RegisterType makes the struct type T available to [ApplyNamed] under the given name.
+// This suits plugin systems where each plugin registers its config type up front.
+// Registering a name that's already taken replaces the type registered under it.
+func RegisterType[T any](name string) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	types[name] = reflect.TypeFor[T]()
+}
+
+// ApplyNamed allocates a new value of the type registered under name with
+// [RegisterType] and hydrates it the same way as [LoadInto] using the given options. It
+// returns a pointer to the value, e.g. a *PluginConfig for a PluginConfig registered
+// type.
+func ApplyNamed(name string, opts ...Option) (any, error) {
+	typesMu.RLock()
+	targetType, ok := types[name]
+	typesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no config type registered as %q", name)
+	}
+
+	target := reflect.New(targetType).Interface()
+	if _, err := LoadInto(target, opts...); err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
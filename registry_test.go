@@ -0,0 +1,35 @@
+package confetti_test
+
+import (
+	"testing"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyNamed(t *testing.T) {
+	type cachePlugin struct {
+		Size int `conf:"PLUGIN_CACHE_SIZE,default=64"`
+	}
+
+	type authPlugin struct {
+		Issuer string `conf:"PLUGIN_AUTH_ISSUER"`
+	}
+
+	confetti.RegisterType[cachePlugin]("cache")
+	confetti.RegisterType[authPlugin]("auth")
+
+	t.Setenv("PLUGIN_AUTH_ISSUER", "https://auth.local")
+	path := writeFile(t, ".env", "PLUGIN_CACHE_SIZE=128")
+
+	cache, err := confetti.ApplyNamed("cache", confetti.WithFiles(path))
+	require.NoError(t, err)
+	require.Equal(t, &cachePlugin{Size: 128}, cache)
+
+	auth, err := confetti.ApplyNamed("auth")
+	require.NoError(t, err)
+	require.Equal(t, &authPlugin{Issuer: "https://auth.local"}, auth)
+
+	_, err = confetti.ApplyNamed("metrics")
+	require.ErrorContains(t, err, `no config type registered as "metrics"`)
+}
@@ -0,0 +1,204 @@
+package confetti
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// modTimes holds the modification time of each path as of the last time
+// [ApplyIfChanged] applied it, tracked separately for every target.
+var (
+	modTimesMu sync.Mutex
+	modTimes   = make(map[any]map[string]time.Time)
+)
+
+// ApplyIfChanged behaves like [ApplyFiles] but only applies the files if any of them
+// have been modified since the last call to ApplyIfChanged that applied them to target,
+// reporting whether it did. The first call for a target and set of paths always applies
+// them. Modification times are tracked per target and path, so several targets can be
+// kept up to date from the same files. Targets are remembered for the life of the
+// process, so this is intended for repeatedly reloading long lived targets.
+func ApplyIfChanged(target any, paths ...string) (bool, error) {
+	// targets must be pointers, which also makes them safe to use as map keys
+	if _, _, err := getTarget(target); err != nil {
+		return false, err
+	}
+
+	modTimesMu.Lock()
+	defer modTimesMu.Unlock()
+
+	current, err := statModTimes(paths)
+	if err != nil {
+		return false, err
+	}
+
+	if !modTimesChanged(modTimes[target], current) {
+		return false, nil
+	}
+
+	if err := ApplyFiles(target, paths...); err != nil {
+		return false, err
+	}
+
+	if modTimes[target] == nil {
+		modTimes[target] = make(map[string]time.Time, len(current))
+	}
+
+	for path, modTime := range current {
+		modTimes[target][path] = modTime
+	}
+
+	return true, nil
+}
+
+// statModTimes returns the modification time of each path.
+func statModTimes(paths []string) (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing config file: %w", err)
+		}
+
+		modTimes[path] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// modTimesChanged reports whether any path in current was modified since last.
+func modTimesChanged(last, current map[string]time.Time) bool {
+	for path, modTime := range current {
+		if lastModTime, ok := last[path]; !ok || !lastModTime.Equal(modTime) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Diff returns the sorted keys whose values differ between old and new, including keys
+// present in only one of them.
+func Diff(old, new map[string]string) []string {
+	var changed []string
+	for key, val := range new {
+		if oldVal, ok := old[key]; !ok || oldVal != val {
+			changed = append(changed, key)
+		}
+	}
+
+	for key := range old {
+		if _, ok := new[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+
+	slices.Sort(changed)
+	return changed
+}
+
+// WatchFiles applies the given files to target and then polls them every interval
+// until ctx is done, reloading them whenever they're modified. Only keys whose values
+// changed since the previous load, as reported by [Diff], are applied on reload, so
+// every other field is left alone. Keys removed from the files are reported but their
+// fields keep their current values.
+//
+// After each reload that changes any keys, onReload is called with the changed keys, or
+// with an error if the files couldn't be reloaded. onReload must not be nil. Each reload
+// is applied to a copy of target that's only committed once every changed key has been
+// applied, so a failed reload leaves target untouched and is retried on the next poll.
+// Reloads happen on a separate goroutine, so target must only be read from onReload or
+// with other synchronization. Only errors from the initial load are returned.
+func WatchFiles(
+	ctx context.Context,
+	target any,
+	interval time.Duration,
+	onReload func(changed []string, err error),
+	paths ...string,
+) error {
+	if onReload == nil {
+		return errors.New("watching files: onReload must not be nil")
+	}
+
+	_, targetVal, err := getTarget(target)
+	if err != nil {
+		return err
+	}
+
+	modTimes, err := statModTimes(paths)
+	if err != nil {
+		return err
+	}
+
+	last, err := parseFiles(false, paths...)
+	if err != nil {
+		return err
+	}
+
+	if err := Merge(target, last); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := statModTimes(paths)
+			if err != nil {
+				onReload(nil, err)
+				continue
+			}
+
+			if !modTimesChanged(modTimes, current) {
+				continue
+			}
+
+			parsed, err := parseFiles(false, paths...)
+			if err != nil {
+				onReload(nil, err)
+				continue
+			}
+
+			changed := Diff(last, parsed)
+			if len(changed) == 0 {
+				modTimes = current
+				continue
+			}
+
+			updates := make(map[string]string, len(changed))
+			for _, key := range changed {
+				if val, ok := parsed[key]; ok {
+					updates[key] = val
+				}
+			}
+
+			// merge into a copy so a bad value doesn't leave target partially reloaded
+			scratch := reflect.New(targetVal.Type())
+			deepCopy(scratch.Elem(), targetVal)
+			if err := Merge(scratch.Interface(), updates); err != nil {
+				onReload(nil, err)
+				continue
+			}
+
+			targetVal.Set(scratch.Elem())
+			modTimes = current
+			last = parsed
+			onReload(changed, nil)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package confetti_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/eriktate/confetti"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyIfChanged(t *testing.T) {
+	path := writeFile(t, "changed.env", "TEST_NAME=first")
+
+	cfg := testConfig{}
+	changed, err := confetti.ApplyIfChanged(&cfg, path)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "first", cfg.String)
+
+	require.NoError(t, os.WriteFile(path, []byte("TEST_NAME=second"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Time{}, time.Now().Add(-time.Hour)))
+	changed, err = confetti.ApplyIfChanged(&cfg, path)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "second", cfg.String)
+
+	cfg = testConfig{}
+	changed, err = confetti.ApplyIfChanged(&cfg, path)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Empty(t, cfg.String)
+
+	now := time.Now()
+	require.NoError(t, os.Chtimes(path, now, now))
+	changed, err = confetti.ApplyIfChanged(&cfg, path)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "second", cfg.String)
+
+	_, err = confetti.ApplyIfChanged(&cfg, path+".missing")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestApplyIfChangedTargets(t *testing.T) {
+	path := writeFile(t, "shared.env", "TEST_NAME=shared")
+
+	first := testConfig{}
+	changed, err := confetti.ApplyIfChanged(&first, path)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "shared", first.String)
+
+	second := testConfig{}
+	changed, err = confetti.ApplyIfChanged(&second, path)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "shared", second.String)
+
+	changed, err = confetti.ApplyIfChanged(&first, path)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	_, err = confetti.ApplyIfChanged(testConfig{}, path)
+	require.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	old := map[string]string{"HOST": "a", "PORT": "80", "REMOVED": "x"}
+	current := map[string]string{"HOST": "a", "PORT": "81", "ADDED": "y"}
+
+	require.Equal(t, []string{"ADDED", "PORT", "REMOVED"}, confetti.Diff(old, current))
+	require.Empty(t, confetti.Diff(old, old))
+}
+
+func TestWatchFiles(t *testing.T) {
+	path := writeFile(t, "watch.env", "TEST_NAME=watched\nTEST_INT=1")
+
+	type reload struct {
+		changed []string
+		err     error
+	}
+
+	reloads := make(chan reload, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := testConfig{}
+	err := confetti.WatchFiles(ctx, &cfg, 5*time.Millisecond, func(changed []string, err error) {
+		reloads <- reload{changed, err}
+	}, path)
+	require.NoError(t, err)
+	require.Equal(t, "watched", cfg.String)
+	require.Equal(t, 1, cfg.Int)
+
+	// changes to fields that aren't in the files survive reloads
+	cfg.Bool = true
+	cfg.String = "derived"
+
+	require.NoError(t, os.WriteFile(path, []byte("TEST_NAME=watched\nTEST_INT=2"), 0o600))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	select {
+	case r := <-reloads:
+		require.NoError(t, r.err)
+		require.Equal(t, []string{"TEST_INT"}, r.changed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+
+	require.Equal(t, 2, cfg.Int)
+	require.Equal(t, "derived", cfg.String)
+	require.True(t, cfg.Bool)
+
+	require.Error(t, confetti.WatchFiles(ctx, &cfg, time.Second, nil, path+".missing"))
+}
+
+func TestWatchFilesFailedReload(t *testing.T) {
+	path := writeFile(t, "failed.env", "TEST_NAME=watched\nTEST_INT=1")
+
+	type reload struct {
+		changed []string
+		err     error
+	}
+
+	reloads := make(chan reload)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := testConfig{}
+	err := confetti.WatchFiles(ctx, &cfg, 5*time.Millisecond, func(changed []string, err error) {
+		select {
+		case reloads <- reload{changed, err}:
+		case <-ctx.Done():
+		}
+	}, path)
+	require.NoError(t, err)
+
+	// the bad TEST_INT keeps the changed TEST_NAME from being applied too
+	require.NoError(t, os.WriteFile(path, []byte("TEST_NAME=reloaded\nTEST_INT=abc"), 0o600))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	select {
+	case r := <-reloads:
+		require.Error(t, r.err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+	require.Equal(t, "watched", cfg.String)
+	require.Equal(t, 1, cfg.Int)
+
+	// failed reloads are retried even if the fix keeps the same modification time
+	require.NoError(t, os.WriteFile(path, []byte("TEST_NAME=reloaded\nTEST_INT=2"), 0o600))
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case r := <-reloads:
+			if r.err != nil {
+				continue
+			}
+
+			require.Equal(t, []string{"TEST_INT", "TEST_NAME"}, r.changed)
+			require.Equal(t, "reloaded", cfg.String)
+			require.Equal(t, 2, cfg.Int)
+			return
+		case <-timeout:
+			t.Fatal("timed out waiting for reload")
+		}
+	}
+}
+
+func TestWatchFilesNilCallback(t *testing.T) {
+	path := writeFile(t, "nil.env", "TEST_NAME=watched")
+
+	err := confetti.WatchFiles(context.Background(), &testConfig{}, time.Second, nil, path)
+	require.ErrorContains(t, err, "onReload must not be nil")
+}